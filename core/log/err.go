@@ -40,6 +40,12 @@ func (e err) Cause() error {
 	return e.cause
 }
 
+// Unwrap returns the cause of the error, so that the errors package can walk
+// the chain of causes.
+func (e err) Unwrap() error {
+	return e.cause
+}
+
 func (e err) Error() string {
 	if e.cause == nil {
 		return e.msg.Text
@@ -18,11 +18,113 @@
 # build and the file will be recreated, check in the new version.
 
 set(files
+    access.go
+    access_test.go
+    alias.go
+    alias_test.go
+    batch.go
+    batch_test.go
+    cache_policy.go
+    cache_policy_test.go
+    cached.go
+    cached_test.go
+    chunked.go
+    chunked_test.go
+    compute.go
+    compute_test.go
+    copy.go
+    copy_on_resolve.go
+    copy_on_resolve_test.go
+    copy_test.go
     database.go
+    database.pb.go
+    database.proto
+    database_test.go
     debug.go
+    diff.go
+    diff_test.go
+    epoch.go
+    epoch_test.go
+    eventlog.go
+    eventlog_test.go
+    eviction.go
+    eviction_test.go
+    expiry.go
+    expiry_test.go
+    fields.go
+    fields_test.go
+    future.go
+    future_test.go
+    group.go
+    group_test.go
     hash.go
+    hash_test.go
+    inflight.go
+    inflight_test.go
     memory.go
+    meta.go
+    meta_test.go
+    metrics.go
+    metrics_test.go
+    migrate.go
+    migrate_test.go
+    migrating.go
+    migrating_test.go
+    multi.go
+    multi_test.go
+    negative.go
+    negative_test.go
+    normalize.go
+    normalize_test.go
+    override.go
+    override_test.go
+    params.go
+    params_test.go
+    pending.go
+    pending_test.go
+    pool.go
+    pool_test.go
+    priority.go
+    quota.go
+    quota_test.go
+    reader.go
+    reader_test.go
+    recording.go
+    recording_test.go
+    recovery.go
+    recovery_test.go
+    replica.go
+    replica_test.go
     resolvable.go
+    resolve_handler.go
+    resolve_handler_test.go
+    sizer.go
+    sizer_test.go
+    snapshot.go
+    snapshot_test.go
+    stale.go
+    stale_test.go
+    subscribe.go
+    subscribe_test.go
+    timeout.go
+    timeout_test.go
+    to_proto.go
+    to_proto_test.go
+    trace.go
+    trace_test.go
+    transaction.go
+    transaction_test.go
+    transform.go
+    transform_test.go
+    uncached.go
+    uncached_test.go
+    verify.go
+    verify_test.go
+    watchdog.go
+    watchdog_test.go
+    weak.go
+    weak_release_test.go
+    weak_test.go
 )
 set(dirs
 
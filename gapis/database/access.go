@@ -0,0 +1,69 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/fault"
+)
+
+// ErrForbidden is the error an authorize function passed to WithAccessControl
+// can return when the caller may not access an id.
+const ErrForbidden = fault.Const("Access forbidden")
+
+// WithAccessControl returns a Database that forwards all operations to d, but
+// that calls authorize with the caller's context before each resolve and
+// contains. If authorize returns an error then the resolve fails with that
+// error, and contains returns false, without querying d. authorize is
+// expected to read the identity of the caller from the context.
+// Stores are not authorized, as storing a value does not reveal anything
+// about the values already stored.
+func WithAccessControl(d Database, authorize func(ctx context.Context, id id.ID) error) Database {
+	return &accessControl{inner: d, authorize: authorize}
+}
+
+type accessControl struct {
+	inner     Database
+	authorize func(ctx context.Context, id id.ID) error
+}
+
+// Implements Database
+func (d *accessControl) store(ctx context.Context, id id.ID, v interface{}, m proto.Message) error {
+	return d.inner.store(ctx, id, v, m)
+}
+
+// Implements Database
+func (d *accessControl) resolve(ctx context.Context, id id.ID) (interface{}, error) {
+	if err := d.authorize(ctx, id); err != nil {
+		return nil, err
+	}
+	return d.inner.resolve(ctx, id)
+}
+
+// Implements Database
+func (d *accessControl) contains(ctx context.Context, id id.ID) bool {
+	if err := d.authorize(ctx, id); err != nil {
+		return false
+	}
+	return d.inner.contains(ctx, id)
+}
+
+// Implements normalizer
+func (d *accessControl) normalize(m proto.Message) proto.Message {
+	return normalizeWith(d.inner, m)
+}
@@ -0,0 +1,58 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+	"github.com/pkg/errors"
+)
+
+func TestAccessControl(t *testing.T) {
+	ctx := log.Testing(t)
+	// Count the operations that reach the inner database by recording them.
+	ops := &bytes.Buffer{}
+	inner := database.NewRecordingDatabase(database.NewInMemory(ctx), ops)
+	private := map[id.ID]bool{}
+	ctx = database.Put(ctx, database.WithAccessControl(inner, func(ctx context.Context, i id.ID) error {
+		if private[i] {
+			return database.ErrForbidden
+		}
+		return nil
+	}))
+
+	public := &personV2{First: "Public"}
+	secret := &personV2{First: "Secret"}
+	publicID, err := database.Store(ctx, public)
+	assert.For(ctx, "Store public").ThatError(err).Succeeded()
+	secretID, err := database.Store(ctx, secret)
+	assert.For(ctx, "Store secret").ThatError(err).Succeeded()
+	private[secretID] = true
+
+	got, err := database.Resolve(ctx, publicID)
+	assert.For(ctx, "Resolve public").ThatError(err).Succeeded()
+	assert.For(ctx, "Public value").That(got).DeepEquals(public)
+
+	queried := ops.Len()
+	_, err = database.Resolve(ctx, secretID)
+	assert.For(ctx, "Resolve secret").That(errors.Cause(err)).Equals(database.ErrForbidden)
+	assert.For(ctx, "Skipped backend").That(ops.Len()).Equals(queried)
+}
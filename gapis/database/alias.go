@@ -0,0 +1,108 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+)
+
+const (
+	// ErrNoAliases is returned by Alias when the database does not support
+	// aliases.
+	ErrNoAliases = fault.Const("Database does not support aliases")
+	// ErrAliasCycle is returned when resolving an alias that leads back to
+	// itself.
+	ErrAliasCycle = fault.Const("Alias cycle")
+)
+
+// aliaser is the interface implemented by databases that can redirect one id
+// to another.
+type aliaser interface {
+	alias(ctx context.Context, from, to id.ID) error
+}
+
+// Alias makes from an alias of to in the database held by the context, so
+// resolving from resolves to, and from is contained while to is. Aliases can
+// point at other aliases, and at ids that are not stored yet. Resolving an
+// alias that leads back to itself fails with ErrAliasCycle.
+// It is an error to alias an id that is already stored.
+func Alias(ctx context.Context, from, to id.ID) error {
+	a, ok := Get(ctx).(aliaser)
+	if !ok {
+		return ErrNoAliases
+	}
+	return a.alias(ctx, from, to)
+}
+
+// Implements aliaser
+func (d *memory) alias(ctx context.Context, from, to id.ID) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if _, got := d.records[from]; got {
+		return fmt.Errorf("Cannot alias stored resource '%v'", from)
+	}
+	d.aliases[from] = to
+	return nil
+}
+
+// dealiasLocked returns the id that i is an alias of, following chains of
+// aliases, or i if it is not an alias.
+// dealiasLocked must be called with a locked mutex.
+func (d *memory) dealiasLocked(ctx context.Context, i id.ID) (id.ID, error) {
+	if len(d.aliases) == 0 {
+		return i, nil
+	}
+	var seen map[id.ID]bool
+	for {
+		if _, got := d.records[i]; got {
+			return i, nil
+		}
+		to, ok := d.aliases[i]
+		if !ok {
+			return i, nil
+		}
+		if seen == nil {
+			seen = map[id.ID]bool{}
+		} else if seen[i] {
+			return i, log.Errf(ctx, ErrAliasCycle, "Resolving alias '%v'", i)
+		}
+		seen[i] = true
+		i = to
+	}
+}
+
+// lookupLocked returns the id and record of the stored resource that i refers
+// to, after following any aliases of i. If there is no such resource, or it
+// has expired, then lookupLocked returns ErrNotFound.
+// lookupLocked must be called with a locked mutex.
+func (d *memory) lookupLocked(ctx context.Context, i id.ID) (id.ID, *record, error) {
+	i, err := d.dealiasLocked(ctx, i)
+	if err != nil {
+		return i, nil, err
+	}
+	if d.dropExpiredLocked(i) {
+		return i, nil, log.Errf(ctx, ErrNotFound, "Resource '%v' expired", i)
+	}
+	r, got := d.records[i]
+	if !got {
+		return i, nil, log.Errf(ctx, ErrNotFound, "Resource '%v'", i)
+	}
+	return i, r, nil
+}
@@ -0,0 +1,74 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+	"github.com/pkg/errors"
+)
+
+func TestAlias(t *testing.T) {
+	ctx := log.Testing(t)
+	d := database.NewInMemory(ctx)
+	ctx = database.Put(ctx, d)
+
+	c, err := database.Store(ctx, &personV2{First: "Ada"})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	a, b := id.OfString("a"), id.OfString("b")
+	assert.For(ctx, "Alias a").ThatError(database.Alias(ctx, a, b)).Succeeded()
+	assert.For(ctx, "Alias b").ThatError(database.Alias(ctx, b, c)).Succeeded()
+
+	got, err := database.Resolve(ctx, a)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	assert.For(ctx, "Value").That(got).DeepEquals(&personV2{First: "Ada"})
+
+	// Every resolve path follows the alias.
+	_, err = database.ResolveFields(ctx, a)
+	assert.For(ctx, "ResolveFields").ThatError(err).Succeeded()
+	_, meta, err := database.ResolveMeta(ctx, a)
+	assert.For(ctx, "ResolveMeta").ThatError(err).Succeeded()
+	assert.For(ctx, "Meta").That(meta.IsResolvable).Equals(false)
+	got, err = database.GetOrCompute(ctx, a, func(context.Context) (interface{}, error) {
+		return nil, fmt.Errorf("Computed an aliased id")
+	})
+	assert.For(ctx, "GetOrCompute").ThatError(err).Succeeded()
+	assert.For(ctx, "Computed value").That(got).DeepEquals(&personV2{First: "Ada"})
+	got, err = database.ResolveUncached(ctx, a)
+	assert.For(ctx, "ResolveUncached").ThatError(err).Succeeded()
+	assert.For(ctx, "Uncached value").That(got).DeepEquals(&personV2{First: "Ada"})
+
+	err = database.Alias(ctx, c, a)
+	assert.For(ctx, "Alias stored").ThatError(err).Failed()
+}
+
+func TestAliasCycle(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	a, b, c := id.OfString("a"), id.OfString("b"), id.OfString("c")
+	assert.For(ctx, "Alias a").ThatError(database.Alias(ctx, a, b)).Succeeded()
+	assert.For(ctx, "Alias b").ThatError(database.Alias(ctx, b, c)).Succeeded()
+	assert.For(ctx, "Alias c").ThatError(database.Alias(ctx, c, a)).Succeeded()
+
+	_, err := database.Resolve(ctx, a)
+	assert.For(ctx, "Resolve").That(errors.Cause(err)).Equals(database.ErrAliasCycle)
+}
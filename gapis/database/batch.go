@@ -0,0 +1,133 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/data/id"
+)
+
+// batchResolver is the interface implemented by databases that can resolve
+// many ids at once more efficiently than resolving each in turn.
+type batchResolver interface {
+	// resolveBatch resolves all the ids, returning the values in the same order.
+	resolveBatch(context.Context, []id.ID) ([]interface{}, error)
+}
+
+// ResolveBatch is a list of ids that are resolved together.
+// It is intended for use by resolvables that resolve many child ids.
+type ResolveBatch struct {
+	ctx context.Context
+	ids []id.ID
+}
+
+// Batch returns a new, empty ResolveBatch that resolves with the database held
+// by the context.
+func Batch(ctx context.Context) *ResolveBatch {
+	return &ResolveBatch{ctx: ctx}
+}
+
+// Add appends id to the list of ids to resolve.
+func (b *ResolveBatch) Add(id id.ID) {
+	b.ids = append(b.ids, id)
+}
+
+// Resolve resolves all the ids added to the batch, returning the values in the
+// same order as they were added. All the resolves are started before any are
+// waited on, so the ids are resolved in parallel. Ids overridden with
+// WithResolvableOverride call their override instead.
+func (b *ResolveBatch) Resolve() ([]interface{}, error) {
+	out := make([]interface{}, len(b.ids))
+	ids, indices := make([]id.ID, 0, len(b.ids)), make([]int, 0, len(b.ids))
+	for i, id := range b.ids {
+		if fn := overrideFor(b.ctx, id); fn != nil {
+			v, err := fn(b.ctx)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		} else {
+			ids, indices = append(ids, id), append(indices, i)
+		}
+	}
+	if len(ids) == 0 {
+		return out, nil
+	}
+
+	d := Get(b.ctx)
+	if br, ok := d.(batchResolver); ok {
+		vals, err := br.resolveBatch(b.ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range vals {
+			out[indices[i]] = v
+		}
+		return out, nil
+	}
+	for i, id := range ids {
+		v, err := d.resolve(b.ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		out[indices[i]] = v
+	}
+	return out, nil
+}
+
+// Implements batchResolver
+func (d *memory) resolveBatch(ctx context.Context, ids []id.ID) ([]interface{}, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	type pending struct {
+		id   id.ID
+		r    *record
+		rs   *resolveState
+		wait bool
+	}
+	all := make([]pending, len(ids))
+	for i, id := range ids {
+		id, err := d.partitionLocked(ctx, id)
+		if err == nil {
+			var p pending
+			p.r, p.rs, p.wait, err = d.beginResolveLocked(ctx, id)
+			p.id = id
+			all[i] = p
+		}
+		if err != nil {
+			// Release the resolves that have already begun.
+			for _, p := range all[:i] {
+				d.releaseLocked(p.id, p.r, p.rs, p.wait)
+			}
+			return nil, err
+		}
+	}
+
+	out := make([]interface{}, len(ids))
+	var firstErr error
+	for i, p := range all {
+		if firstErr != nil {
+			d.releaseLocked(p.id, p.r, p.rs, p.wait)
+			continue
+		}
+		out[i], firstErr = d.endResolveLocked(ctx, p.id, p.r, p.rs, p.wait)
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
@@ -0,0 +1,110 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+const fanOut = 100
+
+var fanOutChildren = func() []*testResolvable {
+	out := make([]*testResolvable, fanOut)
+	for i := range out {
+		i := i
+		out[i] = newResolvable(fmt.Sprintf("fan-out-child-%d", i), func(context.Context) (interface{}, error) {
+			return i, nil
+		})
+	}
+	return out
+}()
+
+// storeFanOut stores the fan-out children and a parent resolvable that
+// resolves them all using resolveChildren, returning the parent's id.
+func storeFanOut(ctx context.Context, name string, resolveChildren func(context.Context, []id.ID) ([]interface{}, error)) (id.ID, error) {
+	ids := make([]id.ID, len(fanOutChildren))
+	for i, c := range fanOutChildren {
+		var err error
+		if ids[i], err = database.Store(ctx, c); err != nil {
+			return id.ID{}, err
+		}
+	}
+	return database.Store(ctx, newResolvable(name, func(ctx context.Context) (interface{}, error) {
+		return resolveChildren(ctx, ids)
+	}))
+}
+
+func resolveSequential(ctx context.Context, ids []id.ID) ([]interface{}, error) {
+	out := make([]interface{}, len(ids))
+	for i, id := range ids {
+		v, err := database.Resolve(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func resolveBatch(ctx context.Context, ids []id.ID) ([]interface{}, error) {
+	b := database.Batch(ctx)
+	for _, id := range ids {
+		b.Add(id)
+	}
+	return b.Resolve()
+}
+
+func TestBatch(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	parent, err := storeFanOut(ctx, "fan-out-batch-test", resolveBatch)
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	got, err := database.Resolve(ctx, parent)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	values := got.([]interface{})
+	assert.For(ctx, "Count").That(len(values)).Equals(fanOut)
+	for i, v := range values {
+		assert.For(ctx, "Value %d", i).That(v).Equals(i)
+	}
+}
+
+func benchmarkFanOut(b *testing.B, name string, resolveChildren func(context.Context, []id.ID) ([]interface{}, error)) {
+	for i := 0; i < b.N; i++ {
+		ctx := context.Background()
+		ctx = database.Put(ctx, database.NewInMemory(ctx))
+		parent, err := storeFanOut(ctx, name, resolveChildren)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := database.Resolve(ctx, parent); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFanOutSequential(b *testing.B) {
+	benchmarkFanOut(b, "fan-out-sequential", resolveSequential)
+}
+
+func BenchmarkFanOutBatch(b *testing.B) {
+	benchmarkFanOut(b, "fan-out-batch", resolveBatch)
+}
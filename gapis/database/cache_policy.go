@@ -0,0 +1,66 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// CachePolicy controls how long the database caches a resolved value.
+type CachePolicy struct {
+	noCache  bool
+	ttl      time.Duration
+	volatile bool
+}
+
+var (
+	// DefaultCache caches the resolved value for the lifetime of the database.
+	DefaultCache = CachePolicy{}
+	// NoCache rebuilds the value for every resolve that starts after the value
+	// was built. Callers already waiting on the resolve share the value.
+	NoCache = CachePolicy{noCache: true}
+	// Volatile caches the resolved value until the next call to BumpEpoch.
+	// Use it for values that depend on state outside of the database, such
+	// as the connected devices or the loaded config.
+	Volatile = CachePolicy{volatile: true}
+)
+
+// TTL returns a CachePolicy that caches the resolved value for d, after which
+// the value is rebuilt by the next resolve.
+func TTL(d time.Duration) CachePolicy {
+	return CachePolicy{ttl: d}
+}
+
+// expires returns the time a value built at now expires, or the zero time if
+// the value never expires.
+func (p CachePolicy) expires(now time.Time) time.Time {
+	switch {
+	case p.noCache:
+		return now
+	case p.ttl > 0:
+		return now.Add(p.ttl)
+	}
+	return time.Time{}
+}
+
+// CacheControl is the interface for types that, like Resolvable, redirect
+// database resolves to a lazily built object, but that also control how long
+// the database caches the built object.
+type CacheControl interface {
+	// ResolveWithPolicy constructs and returns the lazily-built object along
+	// with the policy for caching it.
+	ResolveWithPolicy(ctx context.Context) (interface{}, CachePolicy, error)
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+var policyResolveCount int32
+
+// policyResolvable resolves to the number of times any policyResolvable has
+// been resolved, cached using the policy named by Policy.
+type policyResolvable struct {
+	Policy string `protobuf:"bytes,1,opt,name=policy"`
+}
+
+func (m *policyResolvable) Reset()         { *m = policyResolvable{} }
+func (m *policyResolvable) String() string { return proto.CompactTextString(m) }
+func (*policyResolvable) ProtoMessage()    {}
+
+func (m *policyResolvable) ResolveWithPolicy(ctx context.Context) (interface{}, database.CachePolicy, error) {
+	n := atomic.AddInt32(&policyResolveCount, 1)
+	switch m.Policy {
+	case "no-cache":
+		return n, database.NoCache, nil
+	case "ttl":
+		return n, database.TTL(20 * time.Millisecond), nil
+	case "volatile":
+		return n, database.Volatile, nil
+	}
+	return n, database.DefaultCache, nil
+}
+
+func resolveCount(ctx context.Context, policy string) int32 {
+	i, err := database.Store(ctx, &policyResolvable{Policy: policy})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	got, err := database.Resolve(ctx, i)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	return got.(int32)
+}
+
+func TestCachePolicy(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	first := resolveCount(ctx, "default")
+	assert.For(ctx, "Default cached").That(resolveCount(ctx, "default")).Equals(first)
+
+	first = resolveCount(ctx, "no-cache")
+	second := resolveCount(ctx, "no-cache")
+	assert.For(ctx, "NoCache recomputes").That(second > first).Equals(true)
+	assert.For(ctx, "NoCache recomputes again").That(resolveCount(ctx, "no-cache") > second).Equals(true)
+
+	first = resolveCount(ctx, "ttl")
+	assert.For(ctx, "TTL cached").That(resolveCount(ctx, "ttl")).Equals(first)
+	time.Sleep(40 * time.Millisecond)
+	assert.For(ctx, "TTL expired").That(resolveCount(ctx, "ttl") > first).Equals(true)
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/gapid/core/data/id"
+)
+
+// cachedResolver is the interface implemented by databases that can return a
+// resolved value without building it.
+type cachedResolver interface {
+	resolveCached(context.Context, id.ID) (interface{}, bool, error)
+}
+
+// ResolveCachedOnly returns the value of id from the database held by the
+// context if the value has already been resolved, and true. If the value has
+// not been resolved, or is still resolving, then ResolveCachedOnly returns
+// nil and false without starting a resolve.
+// Databases that do not cache resolved values always return false.
+func ResolveCachedOnly(ctx context.Context, id id.ID) (interface{}, bool, error) {
+	if cr, ok := Get(ctx).(cachedResolver); ok {
+		return cr.resolveCached(ctx, id)
+	}
+	return nil, false, nil
+}
+
+// Implements cachedResolver
+func (d *memory) resolveCached(ctx context.Context, id id.ID) (interface{}, bool, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	id, err := d.partitionLocked(ctx, id)
+	if err != nil {
+		return nil, false, err
+	}
+	id, r, err := d.lookupLocked(ctx, id)
+	if err != nil {
+		return nil, false, err
+	}
+	rs := r.resolveState
+	if rs == nil || rs.finished != nil || rs.err != nil || (r.pins == 0 && rs.expired(time.Now())) {
+		return nil, false, nil
+	}
+	r.generation = d.generation
+	if d.copyResolved {
+		return copyValue(rs.value), true, nil
+	}
+	return rs.value, true, nil
+}
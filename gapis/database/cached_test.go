@@ -0,0 +1,53 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestResolveCachedOnly(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	calls := 0
+	i, err := database.Store(ctx, newResolvable("cached-only", func(context.Context) (interface{}, error) {
+		calls++
+		return "built", nil
+	}))
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+
+	for j := 0; j < 3; j++ {
+		v, ok, err := database.ResolveCachedOnly(ctx, i)
+		assert.For(ctx, "Miss").ThatError(err).Succeeded()
+		assert.For(ctx, "Miss ok").That(ok).Equals(false)
+		assert.For(ctx, "Miss value").That(v).IsNil()
+	}
+	assert.For(ctx, "Calls before resolve").That(calls).Equals(0)
+
+	_, err = database.Resolve(ctx, i)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+
+	v, ok, err := database.ResolveCachedOnly(ctx, i)
+	assert.For(ctx, "Hit").ThatError(err).Succeeded()
+	assert.For(ctx, "Hit ok").That(ok).Equals(true)
+	assert.For(ctx, "Hit value").That(v).Equals("built")
+	assert.For(ctx, "Calls").That(calls).Equals(1)
+}
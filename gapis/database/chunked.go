@@ -0,0 +1,121 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/data/id"
+)
+
+const (
+	minChunkSize = 2 << 10  // Chunks are never smaller than this, except the last
+	maxChunkSize = 64 << 10 // Chunks are never larger than this
+	// chunkMask selects the rolling hash bits that must be zero to end a chunk.
+	// 13 bits gives an average chunk size of 8KB.
+	chunkMask = uint64(1<<13-1) << (64 - 13)
+)
+
+// gearTable is the table of pseudo-random values used by the rolling hash.
+// It is generated using splitmix64 with a fixed seed so that chunk boundaries
+// are stable across processes.
+var gearTable = func() (table [256]uint64) {
+	x := uint64(0)
+	for i := range table {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return
+}()
+
+// nextChunk returns the length of the first content-defined chunk of data.
+// Chunk boundaries are placed where a gear rolling hash of the preceding bytes
+// matches chunkMask, so an edit to data only changes the chunks around it.
+func nextChunk(data []byte) int {
+	if len(data) <= minChunkSize {
+		return len(data)
+	}
+	n := len(data)
+	if n > maxChunkSize {
+		n = maxChunkSize
+	}
+	h := uint64(0)
+	for i := minChunkSize; i < n; i++ {
+		h = (h << 1) + gearTable[data[i]]
+		if h&chunkMask == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// StoreChunked stores data to the database held by the context as a list of
+// content-defined chunks, returning the id of the ChunkedBlob manifest.
+// Each unique chunk is stored just once, so blobs that share content share the
+// storage of their common chunks.
+func StoreChunked(ctx context.Context, data []byte) (id.ID, error) {
+	blob := &ChunkedBlob{Size: uint64(len(data))}
+	for len(data) > 0 {
+		n := nextChunk(data)
+		chunk := &Chunk{Data: append([]byte{}, data[:n]...)}
+		i, err := Store(ctx, chunk)
+		if err != nil {
+			return id.ID{}, err
+		}
+		blob.Chunks = append(blob.Chunks, i[:])
+		data = data[n:]
+	}
+	return Store(ctx, blob)
+}
+
+// ResolveChunked resolves the blob stored with StoreChunked with the manifest
+// id using the database held by the context, returning the reassembled data.
+func ResolveChunked(ctx context.Context, id id.ID) ([]byte, error) {
+	v, err := Resolve(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	blob, ok := v.(*ChunkedBlob)
+	if !ok {
+		return nil, fmt.Errorf("Resource '%v' is not a chunked blob. Got %T", id, v)
+	}
+	b := Batch(ctx)
+	for _, c := range blob.Chunks {
+		b.Add(chunkID(c))
+	}
+	chunks, err := b.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, blob.Size)
+	for i, c := range chunks {
+		chunk, ok := c.(*Chunk)
+		if !ok {
+			return nil, fmt.Errorf("Chunk '%v' of '%v' is not a chunk. Got %T", chunkID(blob.Chunks[i]), id, c)
+		}
+		out = append(out, chunk.Data...)
+	}
+	return out, nil
+}
+
+func chunkID(b []byte) id.ID {
+	out := id.ID{}
+	copy(out[:], b)
+	return out
+}
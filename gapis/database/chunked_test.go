@@ -0,0 +1,75 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestStoreChunkedDedup(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	a := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(a)
+	b := append([]byte{}, a...)
+	for i := 500000; i < 500100; i++ {
+		b[i] ^= 0xff
+	}
+
+	aID, err := database.StoreChunked(ctx, a)
+	assert.For(ctx, "StoreChunked a").ThatError(err).Succeeded()
+	bID, err := database.StoreChunked(ctx, b)
+	assert.For(ctx, "StoreChunked b").ThatError(err).Succeeded()
+
+	for _, test := range []struct {
+		id       id.ID
+		expected []byte
+	}{{aID, a}, {bID, b}} {
+		got, err := database.ResolveChunked(ctx, test.id)
+		assert.For(ctx, "ResolveChunked").ThatError(err).Succeeded()
+		assert.For(ctx, "Data").That(bytes.Equal(got, test.expected)).Equals(true)
+	}
+
+	chunks := func(i id.ID) []string {
+		v, err := database.Resolve(ctx, i)
+		assert.For(ctx, "Resolve manifest").ThatError(err).Succeeded()
+		out := []string{}
+		for _, c := range v.(*database.ChunkedBlob).Chunks {
+			out = append(out, string(c))
+		}
+		return out
+	}
+	aChunks, bChunks := chunks(aID), chunks(bID)
+	inA := map[string]bool{}
+	for _, c := range aChunks {
+		inA[c] = true
+	}
+	shared := 0
+	for _, c := range bChunks {
+		if inA[c] {
+			shared++
+		}
+	}
+	assert.For(ctx, "Chunk count").That(len(bChunks) > 10).Equals(true)
+	assert.For(ctx, "Shared chunks").That(len(bChunks)-shared <= 3).Equals(true)
+}
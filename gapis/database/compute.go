@@ -0,0 +1,155 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/event/task"
+)
+
+// ComputeFunc is the function used by GetOrCompute to build a missing value.
+type ComputeFunc func(ctx context.Context) (interface{}, error)
+
+// computer is the interface implemented by databases that can single-flight
+// calls to GetOrCompute.
+type computer interface {
+	getOrCompute(context.Context, id.ID, ComputeFunc) (interface{}, error)
+}
+
+// computation is an in-flight call to compute for a GetOrCompute.
+type computation struct {
+	done    chan struct{} // Closed when the computation has finished
+	err     error         // Error raised by the computation
+	panic   interface{}   // Value of the panic raised by the computation, if any
+	waiting uint32        // Number of go-routines waiting for the computation
+	cancel  func()        // Cancels the computation's context
+}
+
+// GetOrCompute resolves id with the database held by the context if it is
+// present and not expired, otherwise it calls compute, stores the returned
+// value under id and returns it. Concurrent calls for the same id call compute
+// once, with all callers waiting on the result. compute is called with a
+// context that holds the values of the caller's context, but is only
+// cancelled once every waiting caller has stopped waiting, and a panic raised
+// by compute is raised again in each waiting caller.
+// Databases that do not single-flight GetOrCompute, which includes wrappers
+// such as those built by WithQuota and NewRecordingDatabase, call compute for
+// each concurrent caller that finds id missing.
+func GetOrCompute(ctx context.Context, id id.ID, compute ComputeFunc) (interface{}, error) {
+	d := Get(ctx)
+	if c, ok := d.(computer); ok {
+		return c.getOrCompute(ctx, id, compute)
+	}
+	if d.contains(ctx, id) {
+		return d.resolve(ctx, id)
+	}
+	if err := storeComputed(ctx, d.store, id, compute); err != nil {
+		return nil, err
+	}
+	return d.resolve(ctx, id)
+}
+
+// storeComputed calls compute and stores the result under id using store. id
+// is not the hash of the result, so the store is marked with withDerivedID.
+func storeComputed(ctx context.Context, store func(context.Context, id.ID, interface{}, proto.Message) error, id id.ID, compute ComputeFunc) error {
+	v, err := compute(ctx)
+	if err != nil {
+		return err
+	}
+	m, err := toProto(ctx, v)
+	if err != nil {
+		return err
+	}
+	if v == m {
+		v = nil // v is the proto.
+	}
+	return store(withDerivedID(ctx), id, v, m)
+}
+
+// Implements computer
+func (d *memory) getOrCompute(ctx context.Context, id id.ID, compute ComputeFunc) (interface{}, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if _, _, err := d.lookupLocked(ctx, id); err == nil {
+		return d.resolveLocked(ctx, id)
+	}
+	c, computing := d.computing[id]
+	if !computing {
+		// Compute on a separate go-routine with a context of its own, so that
+		// a single caller cancelling their context doesn't fail the others.
+		// The context keeps the values of the caller's context.
+		computeCtx, cancel := task.WithCancel(keys.Clone(d.resolveCtx, ctx))
+		c = &computation{done: make(chan struct{}), cancel: cancel}
+		d.computing[id] = c
+		go d.compute(computeCtx, id, c, compute)
+	}
+
+	// Wait for either the computation to finish or ctx to be cancelled.
+	c.waiting++
+	d.mutex.Unlock()
+	select {
+	case <-c.done:
+	case <-task.ShouldStop(ctx):
+	}
+	d.mutex.Lock()
+	c.waiting--
+	select {
+	case <-c.done:
+	default:
+		if c.waiting == 0 {
+			// There's no more go-routines waiting for the computation and it
+			// hasn't finished yet. Cancel it.
+			c.cancel()
+			d.removeComputationLocked(id, c)
+		}
+	}
+
+	if err := task.StopReason(ctx); err != nil {
+		return nil, err // Context was cancelled.
+	}
+	if c.panic != nil {
+		panic(c.panic)
+	}
+	if c.err != nil {
+		return nil, c.err // Compute errored.
+	}
+	return d.resolveLocked(ctx, id)
+}
+
+// compute calls compute and stores the result under id, signalling c when it
+// has finished.
+func (d *memory) compute(ctx context.Context, id id.ID, c *computation, compute ComputeFunc) {
+	defer func() {
+		p := recover()
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		c.panic = p
+		d.removeComputationLocked(id, c)
+		close(c.done)
+	}()
+	c.err = storeComputed(ctx, d.store, id, compute)
+}
+
+// removeComputationLocked removes c from the in-flight computations.
+// removeComputationLocked must be called with a locked mutex.
+func (d *memory) removeComputationLocked(id id.ID, c *computation) {
+	if d.computing[id] == c {
+		delete(d.computing, id)
+	}
+}
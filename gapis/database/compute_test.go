@@ -0,0 +1,156 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestGetOrComputeOnce(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	i := id.OfString("computed")
+	calls := int32(0)
+	compute := func(context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return &personV2{First: "Katherine", Last: "Johnson"}, nil
+	}
+
+	wg := sync.WaitGroup{}
+	for n := 0; n < 16; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := database.GetOrCompute(ctx, i, compute)
+			assert.For(ctx, "GetOrCompute").ThatError(err).Succeeded()
+			assert.For(ctx, "Value").That(got).DeepEquals(&personV2{First: "Katherine", Last: "Johnson"})
+		}()
+	}
+	wg.Wait()
+	assert.For(ctx, "Compute calls").That(atomic.LoadInt32(&calls)).Equals(int32(1))
+
+	got, err := database.Resolve(ctx, i)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	assert.For(ctx, "Stored").That(got).DeepEquals(&personV2{First: "Katherine", Last: "Johnson"})
+}
+
+func TestGetOrComputeCancelledCaller(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	i := id.OfString("computed-cancelled")
+	calls, started, gate := int32(0), make(chan struct{}), make(chan struct{})
+	compute := func(ctx context.Context) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+		}
+		select {
+		case <-gate:
+			return &personV2{First: "Grace"}, nil
+		case <-task.ShouldStop(ctx):
+			return nil, task.StopReason(ctx)
+		}
+	}
+
+	// The first caller starts the computation, then gives up on it.
+	firstCtx, cancel := task.WithCancel(ctx)
+	first := make(chan error, 1)
+	go func() {
+		_, err := database.GetOrCompute(firstCtx, i, compute)
+		first <- err
+	}()
+	<-started
+	second := make(chan interface{}, 1)
+	go func() {
+		got, err := database.GetOrCompute(ctx, i, compute)
+		assert.For(ctx, "Second").ThatError(err).Succeeded()
+		second <- got
+	}()
+	time.Sleep(20 * time.Millisecond) // Let the second caller join.
+	cancel()
+	assert.For(ctx, "First").ThatError(<-first).Failed()
+
+	close(gate)
+	assert.For(ctx, "Second value").That(<-second).DeepEquals(&personV2{First: "Grace"})
+	assert.For(ctx, "Compute calls").That(atomic.LoadInt32(&calls)).Equals(int32(1))
+}
+
+func TestGetOrComputePanic(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	i := id.OfString("computed-panic")
+	recovered := func() (p interface{}) {
+		defer func() { p = recover() }()
+		database.GetOrCompute(ctx, i, func(context.Context) (interface{}, error) {
+			panic("compute failed")
+		})
+		return nil
+	}()
+	assert.For(ctx, "Panic").That(recovered).Equals("compute failed")
+
+	// The failed computation does not block later calls.
+	got, err := database.GetOrCompute(ctx, i, func(context.Context) (interface{}, error) {
+		return &personV2{First: "Hedy"}, nil
+	})
+	assert.For(ctx, "After panic").ThatError(err).Succeeded()
+	assert.For(ctx, "After panic value").That(got).DeepEquals(&personV2{First: "Hedy"})
+}
+
+type computeKeyTy string
+
+const computeKey = computeKeyTy("computeKey")
+
+func TestGetOrComputeContextValues(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	ctx = keys.WithValue(ctx, computeKey, "caller")
+
+	got, err := database.GetOrCompute(ctx, id.OfString("context"), func(ctx context.Context) (interface{}, error) {
+		name, _ := ctx.Value(computeKey).(string)
+		return &personV2{First: name}, nil
+	})
+	assert.For(ctx, "GetOrCompute").ThatError(err).Succeeded()
+	assert.For(ctx, "Value").That(got).DeepEquals(&personV2{First: "caller"})
+}
+
+func TestGetOrComputeExpired(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	i, err := database.StoreWithExpiry(ctx, &personV2{First: "Old"}, time.Now().Add(10*time.Millisecond))
+	assert.For(ctx, "StoreWithExpiry").ThatError(err).Succeeded()
+	time.Sleep(20 * time.Millisecond)
+
+	// The expired entry is absent, so it is computed again.
+	got, err := database.GetOrCompute(ctx, i, func(context.Context) (interface{}, error) {
+		return &personV2{First: "New"}, nil
+	})
+	assert.For(ctx, "GetOrCompute").ThatError(err).Succeeded()
+	assert.For(ctx, "Value").That(got).DeepEquals(&personV2{First: "New"})
+}
@@ -0,0 +1,83 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/data/protoconv"
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+)
+
+// ErrNotEnumerable is returned when attempting to copy from a database that
+// cannot list its entries.
+const ErrNotEnumerable = fault.Const("Database does not support enumeration")
+
+// enumerable is the interface implemented by databases that can list their
+// entries.
+type enumerable interface {
+	// entries returns a snapshot of all the id to proto mappings held by the
+	// database, excluding expired entries.
+	entries(context.Context) map[id.ID]proto.Message
+}
+
+// RemapFunc is the function used by CopyWithRemap to transform an entry.
+// It is passed the entry's original id and stored value, and returns the id
+// and value to store in the destination database. If newID is not valid then
+// the id is calculated from the content of newV.
+type RemapFunc func(old id.ID, v interface{}) (newID id.ID, newV interface{}, err error)
+
+// CopyWithRemap copies every entry of src into dst, passing each through remap
+// first. Remapped values are prepared for dst like values passed to Store. The returned map holds the old to new id mapping of each copied entry
+// so that references held elsewhere can be fixed up.
+func CopyWithRemap(ctx context.Context, dst, src Database, remap RemapFunc) (map[id.ID]id.ID, error) {
+	e, ok := src.(enumerable)
+	if !ok {
+		return nil, ErrNotEnumerable
+	}
+	out := map[id.ID]id.ID{}
+	for oldID, m := range e.entries(ctx) {
+		v, err := fromProto(ctx, m)
+		switch err.(type) {
+		case nil:
+		case protoconv.ErrNoConverterRegistered:
+			v = m
+		default:
+			return nil, log.Errf(ctx, err, "Failed to convert %v from proto", oldID)
+		}
+		newID, newV, err := remap(oldID, v)
+		if err != nil {
+			return nil, log.Errf(ctx, err, "Failed to remap %v", oldID)
+		}
+		hashed, newV, newM, err := prepareStore(Put(ctx, dst), newV)
+		if err != nil {
+			return nil, err
+		}
+		storeCtx := ctx
+		if newID.IsValid() {
+			storeCtx = withDerivedID(ctx) // The remapped id is not a hash.
+		} else {
+			newID = hashed
+		}
+		if err := dst.store(storeCtx, newID, newV, newM); err != nil {
+			return nil, err
+		}
+		out[oldID] = newID
+	}
+	return out, nil
+}
@@ -0,0 +1,59 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+var (
+	clonersMutex sync.RWMutex
+	cloners      = map[reflect.Type]func(interface{}) interface{}{}
+)
+
+// WithCopyOnResolve returns an Option that makes resolves return a deep copy
+// of the cached value, so callers that modify a resolved value do not modify
+// the value seen by later resolves. Proto messages are copied with
+// proto.Clone, and values of types registered with RegisterCloner are copied
+// with their cloner. Values of other types are returned as they are, so should
+// be immutable.
+func WithCopyOnResolve() Option {
+	return func(m *memory) { m.copyResolved = true }
+}
+
+// RegisterCloner registers fn as the function used to deep copy resolved
+// values of goType for databases built with WithCopyOnResolve.
+func RegisterCloner(goType reflect.Type, fn func(interface{}) interface{}) {
+	clonersMutex.Lock()
+	defer clonersMutex.Unlock()
+	cloners[goType] = fn
+}
+
+// copyValue returns a deep copy of v.
+func copyValue(v interface{}) interface{} {
+	clonersMutex.RLock()
+	fn, ok := cloners[reflect.TypeOf(v)]
+	clonersMutex.RUnlock()
+	if ok {
+		return fn(v)
+	}
+	if m, ok := v.(proto.Message); ok {
+		return proto.Clone(m)
+	}
+	return v
+}
@@ -0,0 +1,60 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+// counters is a non-proto resolved value copied with a registered cloner.
+type counters struct{ values []int }
+
+func init() {
+	database.RegisterCloner(reflect.TypeOf(&counters{}), func(v interface{}) interface{} {
+		return &counters{append([]int{}, v.(*counters).values...)}
+	})
+}
+
+func TestCopyOnResolve(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx, database.WithCopyOnResolve()))
+
+	stored, err := database.Store(ctx, &personV2{First: "Ada"})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	built, err := database.Store(ctx, newResolvable("copy-on-resolve", func(context.Context) (interface{}, error) {
+		return &counters{[]int{1, 2, 3}}, nil
+	}))
+	assert.For(ctx, "Store resolvable").ThatError(err).Succeeded()
+
+	p, err := database.Resolve(ctx, stored)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	p.(*personV2).First = "Eve"
+	c, err := database.Resolve(ctx, built)
+	assert.For(ctx, "Resolve built").ThatError(err).Succeeded()
+	c.(*counters).values[0] = 100
+
+	p, err = database.Resolve(ctx, stored)
+	assert.For(ctx, "Resolve again").ThatError(err).Succeeded()
+	assert.For(ctx, "Stored value").That(p).DeepEquals(&personV2{First: "Ada"})
+	c, err = database.Resolve(ctx, built)
+	assert.For(ctx, "Resolve built again").ThatError(err).Succeeded()
+	assert.For(ctx, "Built value").That(c).DeepEquals(&counters{[]int{1, 2, 3}})
+}
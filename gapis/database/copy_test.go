@@ -0,0 +1,103 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+type personV1 struct {
+	Name string `protobuf:"bytes,1,opt,name=name"`
+}
+
+func (m *personV1) Reset()         { *m = personV1{} }
+func (m *personV1) String() string { return proto.CompactTextString(m) }
+func (*personV1) ProtoMessage()    {}
+
+type personV2 struct {
+	First string `protobuf:"bytes,1,opt,name=first"`
+	Last  string `protobuf:"bytes,2,opt,name=last"`
+}
+
+func (m *personV2) Reset()         { *m = personV2{} }
+func (m *personV2) String() string { return proto.CompactTextString(m) }
+func (*personV2) ProtoMessage()    {}
+
+func TestCopyWithRemap(t *testing.T) {
+	ctx := log.Testing(t)
+	src, dst := database.NewInMemory(ctx), database.NewInMemory(ctx)
+
+	srcCtx := database.Put(ctx, src)
+	a, err := database.Store(srcCtx, &personV1{Name: "Ada Lovelace"})
+	assert.For(ctx, "Store a").ThatError(err).Succeeded()
+	b, err := database.Store(srcCtx, &personV1{Name: "Alan Turing"})
+	assert.For(ctx, "Store b").ThatError(err).Succeeded()
+
+	remapped, err := database.CopyWithRemap(ctx, dst, src, func(old id.ID, v interface{}) (id.ID, interface{}, error) {
+		parts := strings.SplitN(v.(*personV1).Name, " ", 2)
+		return id.ID{}, &personV2{First: parts[0], Last: parts[1]}, nil
+	})
+	assert.For(ctx, "CopyWithRemap").ThatError(err).Succeeded()
+	assert.For(ctx, "Remapped count").That(len(remapped)).Equals(2)
+
+	dstCtx := database.Put(ctx, dst)
+	for _, test := range []struct {
+		old      id.ID
+		expected *personV2
+	}{
+		{a, &personV2{First: "Ada", Last: "Lovelace"}},
+		{b, &personV2{First: "Alan", Last: "Turing"}},
+	} {
+		newID, ok := remapped[test.old]
+		assert.For(ctx, "Remapped %v", test.old).That(ok).Equals(true)
+		expectedID, err := database.Hash(ctx, test.expected)
+		assert.For(ctx, "Hash").ThatError(err).Succeeded()
+		assert.For(ctx, "New id").That(newID).Equals(expectedID)
+		got, err := database.Resolve(dstCtx, newID)
+		assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+		assert.For(ctx, "Resolved").That(got).DeepEquals(test.expected)
+	}
+}
+
+func TestCopyWithRemapPrepare(t *testing.T) {
+	ctx := log.Testing(t)
+	src, dst := database.NewInMemory(ctx), database.NewInMemory(ctx)
+
+	srcCtx := database.Put(ctx, src)
+	live, err := database.Store(srcCtx, &personV1{Name: "Live"})
+	assert.For(ctx, "Store live").ThatError(err).Succeeded()
+	_, err = database.StoreWithExpiry(srcCtx, &personV1{Name: "Expired"}, time.Now().Add(10*time.Millisecond))
+	assert.For(ctx, "Store expired").ThatError(err).Succeeded()
+	time.Sleep(20 * time.Millisecond)
+
+	// Remapped values are canonicalized before they are hashed, and expired
+	// entries are not copied.
+	remapped, err := database.CopyWithRemap(ctx, dst, src, func(old id.ID, v interface{}) (id.ID, interface{}, error) {
+		return id.ID{}, &rangeResolvable{First: 0, Last: 9}, nil
+	})
+	assert.For(ctx, "CopyWithRemap").ThatError(err).Succeeded()
+	assert.For(ctx, "Remapped count").That(len(remapped)).Equals(1)
+	canonical, err := database.Hash(ctx, &rangeResolvable{First: 0, Count: 10})
+	assert.For(ctx, "Hash").ThatError(err).Succeeded()
+	assert.For(ctx, "New id").That(remapped[live]).Equals(canonical)
+}
@@ -21,8 +21,14 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/google/gapid/core/context/keys"
 	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
 )
 
+// ErrNotFound is returned when resolving an id that is not stored in the
+// database, or whose entry has expired. See StoreWithExpiry.
+const ErrNotFound = fault.Const("Resource not found")
+
 // Database is the interface to a resource store.
 type Database interface {
 	// store adds a key-value pair to the database.
@@ -37,25 +43,52 @@ type Database interface {
 
 // Store stores v to the database held by the context.
 func Store(ctx context.Context, v interface{}) (id.ID, error) {
-	m, err := toProto(ctx, v)
+	i, v, m, err := prepareStore(ctx, v)
 	if err != nil {
 		return id.ID{}, err
 	}
-	i, err := hashProto(v, m)
-	if err != nil {
-		return id.ID{}, err
-	}
-	if v == m {
-		v = nil // v is the proto.
-	}
 	if err := Get(ctx).store(ctx, i, v, m); err != nil {
 		return id.ID{}, err
 	}
 	return i, nil
 }
 
+// prepareStore returns the id, object and proto that v is stored with to the
+// database held by the context.
+func prepareStore(ctx context.Context, v interface{}) (id.ID, interface{}, proto.Message, error) {
+	v = canonicalize(v)
+	m, err := toProto(ctx, v)
+	if err != nil {
+		return id.ID{}, nil, nil, err
+	}
+	normalized := normalizeFor(ctx, m)
+	i, err := hashProto(v, normalized)
+	if err != nil {
+		return id.ID{}, nil, nil, err
+	}
+	if v == m || normalized != m {
+		v = nil // v is the proto, or differs from the normalized proto.
+	}
+	return i, v, normalized, nil
+}
+
+// StoreManyResults stores each of the values in vs to the database held by the
+// context, returning the id and error of each value at the same index as the
+// value. Failing to store a value does not prevent the other values from being
+// stored. Values that fail to store have an invalid id and a non-nil error.
+func StoreManyResults(ctx context.Context, vs []interface{}) ([]id.ID, []error) {
+	ids, errs := make([]id.ID, len(vs)), make([]error, len(vs))
+	for i, v := range vs {
+		ids[i], errs[i] = Store(ctx, v)
+	}
+	return ids, errs
+}
+
 // Resolve resolves id with the database held by the context.
 func Resolve(ctx context.Context, id id.ID) (interface{}, error) {
+	if fn := overrideFor(ctx, id); fn != nil {
+		return fn(ctx)
+	}
 	return Get(ctx).resolve(ctx, id)
 }
 
@@ -66,7 +99,7 @@ func Build(ctx context.Context, r Resolvable) (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
-	return Get(ctx).resolve(ctx, id)
+	return Resolve(ctx, id)
 }
 
 type databaseKeyTy string
@@ -75,12 +108,24 @@ const databaseKey = databaseKeyTy("database")
 
 // Get returns the Database attached to the given context.
 func Get(ctx context.Context) Database {
-	if val := ctx.Value(databaseKey); val != nil {
-		return val.(Database)
+	if d := lookup(ctx); d != nil {
+		return d
 	}
 	panic("database missing from context")
 }
 
+// lookup returns the Database attached to the given context, or nil if the
+// context has no database.
+func lookup(ctx context.Context) Database {
+	switch val := ctx.Value(databaseKey).(type) {
+	case Database:
+		return val
+	case *pendingDatabase:
+		return val.get()
+	}
+	return nil
+}
+
 // Put amends a Context by attaching a Database reference to it.
 func Put(ctx context.Context, d Database) context.Context {
 	if val := ctx.Value(databaseKey); val != nil {
@@ -88,3 +133,15 @@ func Put(ctx context.Context, d Database) context.Context {
 	}
 	return keys.WithValue(ctx, databaseKey, d)
 }
+
+// EnsureDatabase returns ctx if it already holds a Database, otherwise it
+// returns a new context holding a new in memory database, logging a warning.
+// EnsureDatabase is intended for entry points that cannot guarantee that their
+// callers have attached a database.
+func EnsureDatabase(ctx context.Context) context.Context {
+	if val := ctx.Value(databaseKey); val != nil {
+		return ctx
+	}
+	log.W(ctx, "Context has no database, using a new in memory database")
+	return Put(ctx, NewInMemory(ctx))
+}
@@ -0,0 +1,140 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+var (
+	resolversMutex sync.Mutex
+	resolvers      = map[string]func(context.Context) (interface{}, error){}
+)
+
+// testResolvable is a Resolvable that calls the function registered with
+// newResolvable using the same name.
+type testResolvable struct {
+	Name string `protobuf:"bytes,1,opt,name=name"`
+}
+
+func (m *testResolvable) Reset()         { *m = testResolvable{} }
+func (m *testResolvable) String() string { return proto.CompactTextString(m) }
+func (*testResolvable) ProtoMessage()    {}
+
+func (m *testResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	resolversMutex.Lock()
+	f := resolvers[m.Name]
+	resolversMutex.Unlock()
+	return f(ctx)
+}
+
+// newResolvable returns a new testResolvable that calls f when resolved.
+// name must be unique to the test.
+func newResolvable(name string, f func(context.Context) (interface{}, error)) *testResolvable {
+	resolversMutex.Lock()
+	defer resolversMutex.Unlock()
+	resolvers[name] = f
+	return &testResolvable{Name: name}
+}
+
+func TestEnsureDatabase(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.EnsureDatabase(ctx)
+	d := database.Get(ctx)
+	i, err := database.Store(ctx, "value")
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+
+	ctx = database.EnsureDatabase(ctx)
+	assert.For(ctx, "Existing database kept").That(database.Get(ctx)).Equals(d)
+	_, err = database.Resolve(ctx, i)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+}
+
+func TestStoreManyResults(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	type unconvertible struct{}
+	ids, errs := database.StoreManyResults(ctx, []interface{}{
+		&personV2{First: "Ada"},
+		unconvertible{},
+		&personV2{First: "Alan"},
+	})
+	assert.For(ctx, "ids").That(len(ids)).Equals(3)
+	assert.For(ctx, "errs").That(len(errs)).Equals(3)
+	assert.For(ctx, "Bad value error").ThatError(errs[1]).Failed()
+	assert.For(ctx, "Bad value id").That(ids[1].IsValid()).Equals(false)
+	for _, i := range []int{0, 2} {
+		assert.For(ctx, "Value %d error", i).ThatError(errs[i]).Succeeded()
+		_, err := database.Resolve(ctx, ids[i])
+		assert.For(ctx, "Value %d resolve", i).ThatError(err).Succeeded()
+	}
+}
+
+var rangeBuilds int32
+
+// rangeResolvable resolves to the number of commands in a range, which can be
+// given either by its last command or by its command count.
+type rangeResolvable struct {
+	First uint64 `protobuf:"varint,1,opt,name=first"`
+	Last  uint64 `protobuf:"varint,2,opt,name=last"`
+	Count uint64 `protobuf:"varint,3,opt,name=count"`
+}
+
+func (m *rangeResolvable) Reset()         { *m = rangeResolvable{} }
+func (m *rangeResolvable) String() string { return proto.CompactTextString(m) }
+func (*rangeResolvable) ProtoMessage()    {}
+
+func (m *rangeResolvable) Canonicalize() database.Resolvable {
+	if m.Count != 0 {
+		return m
+	}
+	return &rangeResolvable{First: m.First, Count: m.Last - m.First + 1}
+}
+
+func (m *rangeResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	atomic.AddInt32(&rangeBuilds, 1)
+	return m.Count, nil
+}
+
+func TestCanonicalize(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	atomic.StoreInt32(&rangeBuilds, 0)
+
+	byLast, err := database.Store(ctx, &rangeResolvable{First: 0, Last: 9})
+	assert.For(ctx, "Store by last").ThatError(err).Succeeded()
+	byCount, err := database.Store(ctx, &rangeResolvable{First: 0, Count: 10})
+	assert.For(ctx, "Store by count").ThatError(err).Succeeded()
+	assert.For(ctx, "Same id").That(byLast).Equals(byCount)
+	hashed, err := database.Hash(ctx, &rangeResolvable{First: 0, Last: 9})
+	assert.For(ctx, "Hash").ThatError(err).Succeeded()
+	assert.For(ctx, "Hash id").That(hashed).Equals(byCount)
+
+	for _, i := range []id.ID{byLast, byCount} {
+		got, err := database.Resolve(ctx, i)
+		assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+		assert.For(ctx, "Value").That(got).Equals(uint64(10))
+	}
+	assert.For(ctx, "Builds").That(atomic.LoadInt32(&rangeBuilds)).Equals(int32(1))
+}
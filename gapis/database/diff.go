@@ -0,0 +1,83 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/log"
+)
+
+// DiffResolve is a debugging aid for finding non-deterministic resolvables.
+// It builds r runs times, each in a new in memory database, and compares the
+// serialized results. identical is true if every run produced the same bytes,
+// otherwise diff describes the first line at which a run diverged from the
+// first run.
+func DiffResolve(ctx context.Context, r Resolvable, runs int) (identical bool, diff string, err error) {
+	// Hide any database held by ctx so that each run gets a fresh database.
+	ctx = keys.WithValue(ctx, databaseKey, nil)
+
+	var first proto.Message
+	var firstData []byte
+	for i := 0; i < runs; i++ {
+		runCtx := Put(ctx, NewInMemory(ctx))
+		v, err := Build(runCtx, r)
+		if err != nil {
+			return false, "", log.Errf(ctx, err, "Run %d failed", i)
+		}
+		m, err := toProto(ctx, v)
+		if err != nil {
+			return false, "", err
+		}
+		buf := proto.Buffer{}
+		buf.SetDeterministic(true)
+		if err := buf.Marshal(m); err != nil {
+			return false, "", err
+		}
+		if i == 0 {
+			first, firstData = m, buf.Bytes()
+			continue
+		}
+		if !bytes.Equal(firstData, buf.Bytes()) {
+			return false, diffText(0, first, i, m), nil
+		}
+	}
+	return true, "", nil
+}
+
+// diffText returns a description of the first line that differs between the
+// text forms of the messages a and b, produced by runs i and j.
+func diffText(i int, a proto.Message, j int, b proto.Message) string {
+	aLines := strings.Split(proto.MarshalTextString(a), "\n")
+	bLines := strings.Split(proto.MarshalTextString(b), "\n")
+	for l := 0; l < len(aLines) || l < len(bLines); l++ {
+		aLine, bLine := "<end>", "<end>"
+		if l < len(aLines) {
+			aLine = aLines[l]
+		}
+		if l < len(bLines) {
+			bLine = bLines[l]
+		}
+		if aLine != bLine {
+			return fmt.Sprintf("Run %d differs from run %d at line %d:\n- %s\n+ %s", j, i, l+1, aLine, bLine)
+		}
+	}
+	return fmt.Sprintf("Run %d differs from run %d in encoding only", j, i)
+}
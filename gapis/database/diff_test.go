@@ -0,0 +1,50 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestDiffResolve(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	stable := newResolvable("diff-stable", func(context.Context) (interface{}, error) {
+		return &personV2{First: "Ada", Last: "Lovelace"}, nil
+	})
+	identical, diff, err := database.DiffResolve(ctx, stable, 3)
+	assert.For(ctx, "Stable").ThatError(err).Succeeded()
+	assert.For(ctx, "Stable identical").That(identical).Equals(true)
+	assert.For(ctx, "Stable diff").That(diff).Equals("")
+
+	runs := 0
+	unstable := newResolvable("diff-unstable", func(context.Context) (interface{}, error) {
+		runs++
+		return &personV2{First: "Ada", Last: fmt.Sprint("Lovelace ", runs)}, nil
+	})
+	identical, diff, err = database.DiffResolve(ctx, unstable, 3)
+	assert.For(ctx, "Unstable").ThatError(err).Succeeded()
+	assert.For(ctx, "Unstable identical").That(identical).Equals(false)
+	assert.For(ctx, "Unstable diff").That(strings.Contains(diff, `"Lovelace 2"`)).Equals(true)
+	assert.For(ctx, "Runs").That(runs).Equals(2)
+}
@@ -0,0 +1,40 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/google/gapid/core/log"
+)
+
+// epoch is incremented by BumpEpoch.
+var epoch uint64
+
+// BumpEpoch starts a new epoch, so that the next resolve of every value cached
+// with the Volatile policy, and of every partition of a ParamsResolvable,
+// rebuilds the value. Call it when state outside of the database that these
+// values depend on changes. Values built from content addressed data are
+// unaffected.
+func BumpEpoch(ctx context.Context) {
+	e := atomic.AddUint64(&epoch, 1)
+	log.D(ctx, "Database epoch bumped to %v", e)
+}
+
+// currentEpoch returns the current epoch.
+func currentEpoch() uint64 {
+	return atomic.LoadUint64(&epoch)
+}
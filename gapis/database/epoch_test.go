@@ -0,0 +1,38 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestBumpEpoch(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	volatile := resolveCount(ctx, "volatile")
+	immutable := resolveCount(ctx, "default")
+	assert.For(ctx, "Volatile cached").That(resolveCount(ctx, "volatile")).Equals(volatile)
+
+	database.BumpEpoch(ctx)
+	again := resolveCount(ctx, "volatile")
+	assert.For(ctx, "Volatile recomputed").That(again > volatile).Equals(true)
+	assert.For(ctx, "Volatile cached again").That(resolveCount(ctx, "volatile")).Equals(again)
+	assert.For(ctx, "Immutable cached").That(resolveCount(ctx, "default")).Equals(immutable)
+}
@@ -0,0 +1,68 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/data/id"
+)
+
+// AppendLog stores entry to the database held by the context as the next entry
+// of the append-only log with the head headID, returning the id of the new
+// head. An invalid headID starts a new log.
+// Each entry holds the id of the entry before it, so the head id identifies
+// the entire content of the log.
+func AppendLog(ctx context.Context, headID id.ID, entry interface{}) (newHeadID id.ID, err error) {
+	valueID, err := Store(ctx, entry)
+	if err != nil {
+		return id.ID{}, err
+	}
+	e := &LogEntry{Value: valueID[:]}
+	if headID.IsValid() {
+		e.Prev = headID[:]
+	}
+	return Store(ctx, e)
+}
+
+// WalkLog resolves each entry of the append-only log with the head headID and
+// calls fn with the entries in the order they were appended. WalkLog stops at
+// the first error returned by fn, and returns it.
+func WalkLog(ctx context.Context, headID id.ID, fn func(interface{}) error) error {
+	values := []id.ID{}
+	for i := headID; i.IsValid(); {
+		v, err := Resolve(ctx, i)
+		if err != nil {
+			return err
+		}
+		e, ok := v.(*LogEntry)
+		if !ok {
+			return fmt.Errorf("Resource '%v' is not a log entry. Got %T", i, v)
+		}
+		values = append(values, chunkID(e.Value))
+		i = chunkID(e.Prev)
+	}
+	for i := len(values) - 1; i >= 0; i-- {
+		v, err := Resolve(ctx, values[i])
+		if err != nil {
+			return err
+		}
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
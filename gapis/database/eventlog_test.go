@@ -0,0 +1,65 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestAppendLog(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	const count = 10
+	head := id.ID{}
+	heads := []id.ID{}
+	for i := 0; i < count; i++ {
+		var err error
+		head, err = database.AppendLog(ctx, head, &personV2{First: fmt.Sprint("Person ", i)})
+		assert.For(ctx, "AppendLog").ThatError(err).Succeeded()
+		heads = append(heads, head)
+	}
+
+	got := []string{}
+	err := database.WalkLog(ctx, head, func(v interface{}) error {
+		got = append(got, v.(*personV2).First)
+		return nil
+	})
+	assert.For(ctx, "WalkLog").ThatError(err).Succeeded()
+	expected := []string{}
+	for i := 0; i < count; i++ {
+		expected = append(expected, fmt.Sprint("Person ", i))
+	}
+	assert.For(ctx, "Entries").ThatSlice(got).Equals(expected)
+
+	// Earlier heads still identify the earlier logs.
+	n := 0
+	err = database.WalkLog(ctx, heads[2], func(v interface{}) error { n++; return nil })
+	assert.For(ctx, "WalkLog earlier head").ThatError(err).Succeeded()
+	assert.For(ctx, "Earlier entries").That(n).Equals(3)
+
+	const errStop = fault.Const("stop")
+	n = 0
+	err = database.WalkLog(ctx, head, func(v interface{}) error { n++; return errStop })
+	assert.For(ctx, "WalkLog error").ThatError(err).Equals(errStop)
+	assert.For(ctx, "Entries before error").That(n).Equals(1)
+}
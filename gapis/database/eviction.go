@@ -0,0 +1,293 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"container/heap"
+	"container/list"
+	"context"
+	"sort"
+
+	"github.com/google/gapid/core/data/id"
+)
+
+// EvictionPolicy picks the values built by resolvables to release when a
+// database built with NewMemoryDatabaseWithPolicy is over its size limit.
+// Policies are called with the database locked, so they do not need to be
+// safe for concurrent use.
+type EvictionPolicy interface {
+	// RecordAccess is called each time the value for id is resolved.
+	RecordAccess(id id.ID)
+	// RecordStore is called each time a value of size bytes is built for id.
+	RecordStore(id id.ID, size uint64)
+	// Evict removes and returns the id of the next value to release, or
+	// returns false if the policy holds no ids.
+	Evict() (id.ID, bool)
+}
+
+// NewMemoryDatabaseWithPolicy builds a new in memory database that releases
+// the values built by resolvables, in the order picked by policy, whenever the
+// accounted size of the built values is more than maxBytes. Released values
+// are transparently rebuilt from their resolvable on the next resolve.
+// Stored protos are never released, and are not counted against maxBytes.
+func NewMemoryDatabaseWithPolicy(ctx context.Context, maxBytes uint64, policy EvictionPolicy, opts ...Option) Database {
+	m := NewInMemory(ctx, opts...).(*memory)
+	m.maxBytes, m.policy = maxBytes, policy
+	return m
+}
+
+// defaultEvictionWatermark is the fraction of the size limit that built values
+// are released down to when the limit is exceeded.
+const defaultEvictionWatermark = 0.9
+
+// WithEvictionWatermark returns an Option that sets the fraction of the size
+// limit of a database built with NewMemoryDatabaseWithPolicy that built values
+// are released down to once the limit is exceeded. Releasing values in batches
+// means that a burst of builds over the limit does not release a value on each
+// build. low must be in the range (0, 1], where 1 releases just enough values
+// to get back within the limit. The default is 0.9.
+func WithEvictionWatermark(low float64) Option {
+	return func(m *memory) { m.watermark = low }
+}
+
+// WithCostAwareEviction returns an Option that weights the values picked for
+// release by a database built with NewMemoryDatabaseWithPolicy by their size.
+// Instead of releasing the values in policy order, the database takes values
+// from the policy until they cover twice the bytes that need to be released,
+// then releases the values with the fewest resolves per byte first. This
+// prefers releasing one large value over many small frequently resolved
+// values. Candidates that are not released are given back to the policy as if
+// they were just built.
+func WithCostAwareEviction() Option {
+	return func(m *memory) { m.costAware = true }
+}
+
+// evictLocked releases built values once they are over the size limit, until
+// they are down to the low watermark or the policy has nothing left to evict.
+// evictLocked must be called with a locked mutex.
+func (d *memory) evictLocked() {
+	if d.builtSize <= d.maxBytes {
+		return
+	}
+	watermark := d.watermark
+	if watermark <= 0 || watermark > 1 {
+		watermark = defaultEvictionWatermark
+	}
+	low := uint64(float64(d.maxBytes) * watermark)
+	if d.costAware {
+		d.evictCostAwareLocked(low)
+		return
+	}
+	pinned := []id.ID{}
+	for d.builtSize > low {
+		id, ok := d.policy.Evict()
+		if !ok {
+			break
+		}
+		r, got := d.records[id]
+		if !got || !r.recomputable || r.resolveState == nil || r.resolveState.finished != nil {
+			continue // Value is no longer built, or is being built.
+		}
+		if r.pins > 0 {
+			pinned = append(pinned, id) // Value is held by a snapshot.
+			continue
+		}
+		d.invalidateLocked(id, r)
+		d.counters.evictions++
+	}
+	// Give the pinned values back to the policy so they can be evicted once
+	// released.
+	for _, id := range pinned {
+		d.policy.RecordStore(id, d.records[id].builtSize)
+	}
+}
+
+// evictCostAwareLocked releases built values, picked from the candidates
+// offered by the policy by their resolves per byte, until they are down to low.
+// evictCostAwareLocked must be called with a locked mutex.
+func (d *memory) evictCostAwareLocked(low uint64) {
+	needed := d.builtSize - low
+	candidates, covered := []id.ID{}, uint64(0)
+	keep := []id.ID{} // Values to give back to the policy
+	for covered < 2*needed {
+		id, ok := d.policy.Evict()
+		if !ok {
+			break
+		}
+		r, got := d.records[id]
+		if !got || !r.recomputable || r.resolveState == nil || r.resolveState.finished != nil {
+			continue // Value is no longer built, or is being built.
+		}
+		if r.pins > 0 {
+			keep = append(keep, id) // Value is held by a snapshot.
+			continue
+		}
+		candidates = append(candidates, id)
+		covered += r.builtSize
+	}
+	// Release the values that are resolved the least for their size first.
+	// Comparing hits * size avoids dividing by a zero size.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := d.records[candidates[i]], d.records[candidates[j]]
+		return (a.hits+1)*b.builtSize < (b.hits+1)*a.builtSize
+	})
+	for _, id := range candidates {
+		if d.builtSize <= low {
+			keep = append(keep, id)
+			continue
+		}
+		d.invalidateLocked(id, d.records[id])
+		d.counters.evictions++
+	}
+	for _, id := range keep {
+		d.policy.RecordStore(id, d.records[id].builtSize)
+	}
+}
+
+// NewLRU returns an EvictionPolicy that evicts the least recently resolved
+// value first.
+func NewLRU() EvictionPolicy {
+	return &lru{order: list.New(), elements: map[id.ID]*list.Element{}}
+}
+
+type lru struct {
+	order    *list.List // Most recently used at the front
+	elements map[id.ID]*list.Element
+}
+
+func (p *lru) RecordAccess(id id.ID) {
+	if e, ok := p.elements[id]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *lru) RecordStore(id id.ID, size uint64) {
+	if e, ok := p.elements[id]; ok {
+		p.order.MoveToFront(e)
+		return
+	}
+	p.elements[id] = p.order.PushFront(id)
+}
+
+func (p *lru) Evict() (id.ID, bool) {
+	e := p.order.Back()
+	if e == nil {
+		return id.ID{}, false
+	}
+	i := p.order.Remove(e).(id.ID)
+	delete(p.elements, i)
+	return i, true
+}
+
+// NewFIFO returns an EvictionPolicy that evicts the value that was built
+// first, regardless of how it has been resolved since.
+func NewFIFO() EvictionPolicy {
+	return &fifo{order: list.New(), elements: map[id.ID]*list.Element{}}
+}
+
+type fifo struct {
+	order    *list.List // Oldest at the front
+	elements map[id.ID]*list.Element
+}
+
+func (p *fifo) RecordAccess(id id.ID) {}
+
+func (p *fifo) RecordStore(id id.ID, size uint64) {
+	if _, ok := p.elements[id]; !ok {
+		p.elements[id] = p.order.PushBack(id)
+	}
+}
+
+func (p *fifo) Evict() (id.ID, bool) {
+	e := p.order.Front()
+	if e == nil {
+		return id.ID{}, false
+	}
+	i := p.order.Remove(e).(id.ID)
+	delete(p.elements, i)
+	return i, true
+}
+
+// NewLFU returns an EvictionPolicy that evicts the least frequently resolved
+// value first. Values resolved equally often are evicted oldest first.
+func NewLFU() EvictionPolicy {
+	return &lfu{entries: map[id.ID]*lfuEntry{}}
+}
+
+type lfuEntry struct {
+	id    id.ID
+	count uint64 // Number of accesses
+	seq   uint64 // Order the entry was added
+	index int    // Index in the heap
+}
+
+type lfu struct {
+	heap    lfuHeap
+	entries map[id.ID]*lfuEntry
+	seq     uint64
+}
+
+func (p *lfu) RecordAccess(id id.ID) {
+	if e, ok := p.entries[id]; ok {
+		e.count++
+		heap.Fix(&p.heap, e.index)
+	}
+}
+
+func (p *lfu) RecordStore(id id.ID, size uint64) {
+	if _, ok := p.entries[id]; ok {
+		return
+	}
+	p.seq++
+	e := &lfuEntry{id: id, seq: p.seq}
+	p.entries[id] = e
+	heap.Push(&p.heap, e)
+}
+
+func (p *lfu) Evict() (id.ID, bool) {
+	if len(p.heap) == 0 {
+		return id.ID{}, false
+	}
+	e := heap.Pop(&p.heap).(*lfuEntry)
+	delete(p.entries, e.id)
+	return e.id, true
+}
+
+// lfuHeap implements heap.Interface, ordering the least frequently used entry
+// first.
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].seq < h[j].seq
+}
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *lfuHeap) Push(x interface{}) {
+	e := x.(*lfuEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,271 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestEvictionPolicies(t *testing.T) {
+	ctx := log.Testing(t)
+	a, b, c := id.OfString("a"), id.OfString("b"), id.OfString("c")
+	names := map[id.ID]string{a: "a", b: "b", c: "c"}
+
+	for _, test := range []struct {
+		name     string
+		policy   database.EvictionPolicy
+		expected []string
+	}{
+		{"LRU", database.NewLRU(), []string{"b", "c", "a"}},
+		{"LFU", database.NewLFU(), []string{"b", "c", "a"}},
+		{"FIFO", database.NewFIFO(), []string{"a", "b", "c"}},
+	} {
+		ctx := log.Enter(ctx, test.name)
+		p := test.policy
+		p.RecordStore(a, 10)
+		p.RecordStore(b, 10)
+		p.RecordStore(c, 10)
+		p.RecordAccess(a)
+		p.RecordAccess(c)
+		p.RecordAccess(a)
+		got := []string{}
+		for i, ok := p.Evict(); ok; i, ok = p.Evict() {
+			got = append(got, names[i])
+		}
+		assert.For(ctx, "Eviction order").ThatSlice(got).Equals(test.expected)
+	}
+}
+
+// sizedValue is a resolved value that reports its size.
+type sizedValue struct{ size uint64 }
+
+func (v sizedValue) SizeBytes() uint64 { return v.size }
+
+func TestMemoryDatabaseWithPolicy(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewMemoryDatabaseWithPolicy(ctx, 250, database.NewLRU()))
+
+	calls := map[string]int{}
+	ids := map[string]id.ID{}
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		i, err := database.Store(ctx, newResolvable("evict-"+name, func(context.Context) (interface{}, error) {
+			calls[name]++
+			return sizedValue{100}, nil
+		}))
+		assert.For(ctx, "Store").ThatError(err).Succeeded()
+		ids[name] = i
+	}
+
+	for _, name := range []string{"a", "b", "c", "b", "a", "c"} {
+		_, err := database.Resolve(ctx, ids[name])
+		assert.For(ctx, "Resolve %v", name).ThatError(err).Succeeded()
+	}
+	assert.For(ctx, "Calls").That(calls).DeepEquals(map[string]int{"a": 2, "b": 1, "c": 2})
+}
+
+func TestMemoryDatabaseWithPolicyIgnoresStoredProtos(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewMemoryDatabaseWithPolicy(ctx, 150, database.NewLRU()))
+
+	// Stored protos well over the limit do not count against it.
+	_, err := database.Store(ctx, &personV2{First: strings.Repeat("x", 1000)})
+	assert.For(ctx, "Store large").ThatError(err).Succeeded()
+
+	calls := 0
+	i, err := database.Store(ctx, newResolvable("evict-protos", func(context.Context) (interface{}, error) {
+		calls++
+		return sizedValue{100}, nil
+	}))
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	for j := 0; j < 3; j++ {
+		_, err := database.Resolve(ctx, i)
+		assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	}
+	assert.For(ctx, "Calls").That(calls).Equals(1)
+}
+
+func TestEvictionWatermark(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewMemoryDatabaseWithPolicy(ctx, 1000, database.NewFIFO(),
+		database.WithEvictionWatermark(0.5)))
+
+	ids := []id.ID{}
+	for i := 0; i < 11; i++ {
+		r, err := database.Store(ctx, newResolvable(fmt.Sprint("watermark-", i), func(context.Context) (interface{}, error) {
+			return sizedValue{100}, nil
+		}))
+		assert.For(ctx, "Store").ThatError(err).Succeeded()
+		ids = append(ids, r)
+		_, err = database.Resolve(ctx, r)
+		assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	}
+	// The 11th build takes the values over the limit, releasing the 6 oldest
+	// values to get down to 500 bytes.
+	for i, r := range ids {
+		_, cached, err := database.ResolveCachedOnly(ctx, r)
+		assert.For(ctx, "ResolveCachedOnly").ThatError(err).Succeeded()
+		assert.For(ctx, "Cached %v", i).That(cached).Equals(i >= 6)
+	}
+}
+
+func TestCostAwareEviction(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		opts         []database.Option
+		smallSurvive bool
+	}{
+		{"LRU", nil, false},
+		{"CostAware", []database.Option{database.WithCostAwareEviction()}, true},
+	} {
+		ctx := log.Enter(log.Testing(t), test.name)
+		ctx = database.Put(ctx, database.NewMemoryDatabaseWithPolicy(ctx, 1000, database.NewLRU(), test.opts...))
+		store := func(name string, size uint64) id.ID {
+			i, err := database.Store(ctx, newResolvable("cost-"+name, func(context.Context) (interface{}, error) {
+				return sizedValue{size}, nil
+			}))
+			assert.For(ctx, "Store %v", name).ThatError(err).Succeeded()
+			return i
+		}
+		resolve := func(i id.ID) {
+			_, err := database.Resolve(ctx, i)
+			assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+		}
+
+		// Small values that are resolved often, but least recently.
+		small := []id.ID{}
+		for i := 0; i < 5; i++ {
+			s := store(fmt.Sprint("small-", i), 10)
+			for j := 0; j < 10; j++ {
+				resolve(s)
+			}
+			small = append(small, s)
+		}
+		cold := store("cold", 600)
+		resolve(cold)
+		// Building the large blob takes the values over the limit.
+		resolve(store("large", 500))
+
+		for i, s := range small {
+			_, cached, err := database.ResolveCachedOnly(ctx, s)
+			assert.For(ctx, "ResolveCachedOnly").ThatError(err).Succeeded()
+			assert.For(ctx, "Small %v cached", i).That(cached).Equals(test.smallSurvive)
+		}
+		_, cached, err := database.ResolveCachedOnly(ctx, cold)
+		assert.For(ctx, "ResolveCachedOnly").ThatError(err).Succeeded()
+		assert.For(ctx, "Cold cached").That(cached).Equals(false)
+	}
+}
+
+func TestRebuiltValueIsNotEvicted(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewMemoryDatabaseWithPolicy(ctx, 250, database.NewLFU()))
+
+	builds := int32(0)
+	release := make(chan struct{})
+	hot, err := database.Store(ctx, newResolvable("rebuilt-hot", func(context.Context) (interface{}, error) {
+		if atomic.AddInt32(&builds, 1) > 1 {
+			<-release // Hold the rebuild until all the callers are waiting on it.
+		}
+		return sizedValue{100}, nil
+	}))
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	store := func(name string) id.ID {
+		i, err := database.Store(ctx, newResolvable("rebuilt-"+name, func(context.Context) (interface{}, error) {
+			return sizedValue{100}, nil
+		}))
+		assert.For(ctx, "Store %v", name).ThatError(err).Succeeded()
+		return i
+	}
+	resolve := func(i id.ID, count int) {
+		for j := 0; j < count; j++ {
+			_, err := database.Resolve(ctx, i)
+			assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+		}
+	}
+
+	resolve(hot, 1)
+	resolve(store("warm"), 5)
+	// Building a third value releases the least frequently resolved value.
+	resolve(store("cold"), 1)
+	_, cached, err := database.ResolveCachedOnly(ctx, hot)
+	assert.For(ctx, "ResolveCachedOnly").ThatError(err).Succeeded()
+	assert.For(ctx, "Evicted").That(cached).Equals(false)
+
+	const callers = 8
+	wg := sync.WaitGroup{}
+	for j := 0; j < callers; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resolve(hot, 1)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.For(ctx, "Builds").That(atomic.LoadInt32(&builds)).Equals(int32(2))
+	_, cached, err = database.ResolveCachedOnly(ctx, hot)
+	assert.For(ctx, "ResolveCachedOnly").ThatError(err).Succeeded()
+	assert.For(ctx, "Resident").That(cached).Equals(true)
+}
+
+// evictBenchResolvable resolves to a 100 byte sizedValue.
+type evictBenchResolvable struct {
+	Index uint64 `protobuf:"varint,1,opt,name=index"`
+}
+
+func (m *evictBenchResolvable) Reset()         { *m = evictBenchResolvable{} }
+func (m *evictBenchResolvable) String() string { return proto.CompactTextString(m) }
+func (*evictBenchResolvable) ProtoMessage()    {}
+
+func (m *evictBenchResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	return sizedValue{100}, nil
+}
+
+func benchmarkEviction(b *testing.B, watermark float64) {
+	ctx := context.Background()
+	ctx = database.Put(ctx, database.NewMemoryDatabaseWithPolicy(ctx, 100*1000, database.NewLRU(),
+		database.WithEvictionWatermark(watermark)))
+	next := uint64(0)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i, err := database.Store(ctx, &evictBenchResolvable{Index: atomic.AddUint64(&next, 1)})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := database.Resolve(ctx, i); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkEvictionPerEntry(b *testing.B) { benchmarkEviction(b, 1) }
+func BenchmarkEvictionBatched(b *testing.B)  { benchmarkEviction(b, 0.9) }
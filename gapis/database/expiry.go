@@ -0,0 +1,85 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/fault"
+)
+
+// ErrNoExpiry is returned by StoreWithExpiry when the database does not
+// support entries that expire.
+const ErrNoExpiry = fault.Const("Database does not support expiring entries")
+
+// expiringStorer is the interface implemented by databases that can store
+// entries that expire.
+type expiringStorer interface {
+	storeWithExpiry(ctx context.Context, id id.ID, v interface{}, m proto.Message, expiresAt time.Time) error
+}
+
+// StoreWithExpiry stores v to the database held by the context, like Store,
+// but the entry is treated as absent once expiresAt has passed: resolves of
+// the id fail with ErrNotFound, and the database no longer contains it.
+// Storing a value that is already stored extends its expiry to the later of
+// the two times, and storing it with Store makes it never expire.
+func StoreWithExpiry(ctx context.Context, v interface{}, expiresAt time.Time) (id.ID, error) {
+	s, ok := Get(ctx).(expiringStorer)
+	if !ok {
+		return id.ID{}, ErrNoExpiry
+	}
+	i, v, m, err := prepareStore(ctx, v)
+	if err != nil {
+		return id.ID{}, err
+	}
+	if err := s.storeWithExpiry(ctx, i, v, m, expiresAt); err != nil {
+		return id.ID{}, err
+	}
+	return i, nil
+}
+
+// Implements expiringStorer
+func (d *memory) storeWithExpiry(ctx context.Context, id id.ID, v interface{}, m proto.Message, expiresAt time.Time) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.dropExpiredLocked(id)
+	_, existed := d.records[id]
+	if err := d.storeLocked(ctx, id, v, m); err != nil {
+		return err
+	}
+	r := d.records[id]
+	if !existed || (!r.expires.IsZero() && r.expires.Before(expiresAt)) {
+		r.expires = expiresAt
+	}
+	return nil
+}
+
+// dropExpiredLocked removes the record with the given id if it has expired,
+// returning true if the record was removed.
+// dropExpiredLocked must be called with a locked mutex.
+func (d *memory) dropExpiredLocked(id id.ID) bool {
+	r, got := d.records[id]
+	if !got || r.expires.IsZero() || time.Now().Before(r.expires) {
+		return false
+	}
+	delete(d.records, id)
+	d.size -= r.size
+	d.builtSize -= r.builtSize
+	d.notifyLocked(id, Evicted)
+	return true
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	stderrors "errors"
+	"testing"
+	"time"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+	"github.com/pkg/errors"
+)
+
+func TestStoreWithExpiry(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	v := &personV2{First: "Grace", Last: "Hopper"}
+	i, err := database.StoreWithExpiry(ctx, v, time.Now().Add(20*time.Millisecond))
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	got, err := database.Resolve(ctx, i)
+	assert.For(ctx, "Resolve before").ThatError(err).Succeeded()
+	assert.For(ctx, "Value").That(got).DeepEquals(v)
+
+	time.Sleep(40 * time.Millisecond)
+	_, err = database.Resolve(ctx, i)
+	assert.For(ctx, "Resolve after").That(errors.Cause(err)).Equals(database.ErrNotFound)
+
+	// Storing the value again without an expiry keeps it.
+	_, err = database.StoreWithExpiry(ctx, v, time.Now().Add(20*time.Millisecond))
+	assert.For(ctx, "Store again").ThatError(err).Succeeded()
+	_, err = database.Store(ctx, v)
+	assert.For(ctx, "Store forever").ThatError(err).Succeeded()
+	time.Sleep(40 * time.Millisecond)
+	_, err = database.Resolve(ctx, i)
+	assert.For(ctx, "Resolve kept").ThatError(err).Succeeded()
+}
+
+func TestExpiredEntryIsAbsent(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	v := &personV2{First: "Ada"}
+	i, err := database.StoreWithExpiry(ctx, v, time.Now().Add(20*time.Millisecond))
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	_, err = database.Resolve(ctx, i)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	_, cached, err := database.ResolveCachedOnly(ctx, i)
+	assert.For(ctx, "ResolveCachedOnly").ThatError(err).Succeeded()
+	assert.For(ctx, "Cached").That(cached).Equals(true)
+
+	time.Sleep(40 * time.Millisecond)
+	_, _, err = database.ResolveCachedOnly(ctx, i)
+	assert.For(ctx, "ResolveCachedOnly").That(stderrors.Is(err, database.ErrNotFound)).Equals(true)
+	_, err = database.ResolveFields(ctx, i)
+	assert.For(ctx, "ResolveFields").That(stderrors.Is(err, database.ErrNotFound)).Equals(true)
+	_, _, err = database.ResolveMeta(ctx, i)
+	assert.For(ctx, "ResolveMeta").That(stderrors.Is(err, database.ErrNotFound)).Equals(true)
+
+	// Ids that were never stored are not found in the same way.
+	missing, err := database.Hash(ctx, &personV2{First: "Missing"})
+	assert.For(ctx, "Hash").ThatError(err).Succeeded()
+	_, err = database.Resolve(ctx, missing)
+	assert.For(ctx, "Resolve missing").That(stderrors.Is(err, database.ErrNotFound)).Equals(true)
+}
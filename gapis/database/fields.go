@@ -0,0 +1,179 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+)
+
+// rawResolver is the interface implemented by databases that can return the
+// encoded proto of a resolved value without converting it to its Go type.
+type rawResolver interface {
+	resolveRaw(context.Context, id.ID) ([]byte, error)
+}
+
+// ResolveFields resolves id with the database held by the context, returning
+// an iterator over the top-level fields of the value's encoded proto. Fields
+// are only decoded when the caller asks for them, so callers only pay for
+// decoding the fields they read.
+func ResolveFields(ctx context.Context, id id.ID) (*FieldIterator, error) {
+	d := Get(ctx)
+	if rr, ok := d.(rawResolver); ok {
+		data, err := rr.resolveRaw(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return &FieldIterator{data: data}, nil
+	}
+	v, err := d.resolve(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := marshalValue(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+	return &FieldIterator{data: data}, nil
+}
+
+func marshalValue(ctx context.Context, v interface{}) ([]byte, error) {
+	m, err := toProto(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(m)
+}
+
+// FieldIterator walks the top-level fields of an encoded proto message in the
+// order they are encoded.
+type FieldIterator struct {
+	data     []byte
+	number   int32
+	wireType int
+	value    []byte
+	err      error
+}
+
+// Next advances the iterator to the next field, returning false when there
+// are no more fields or the message is malformed.
+func (i *FieldIterator) Next() bool {
+	if i.err != nil || len(i.data) == 0 {
+		return false
+	}
+	key, n := binary.Uvarint(i.data)
+	if n <= 0 {
+		return i.fail("Bad field key")
+	}
+	i.data = i.data[n:]
+	i.number, i.wireType = int32(key>>3), int(key&7)
+	switch i.wireType {
+	case proto.WireVarint:
+		if _, n = binary.Uvarint(i.data); n <= 0 {
+			return i.fail("Bad varint")
+		}
+	case proto.WireFixed64:
+		n = 8
+	case proto.WireFixed32:
+		n = 4
+	case proto.WireBytes:
+		size, s := binary.Uvarint(i.data)
+		if s <= 0 || size > uint64(len(i.data)-s) {
+			return i.fail("Bad length")
+		}
+		i.data = i.data[s:]
+		n = int(size)
+	default:
+		return i.fail(fmt.Sprintf("Unsupported wire type %d", i.wireType))
+	}
+	if n > len(i.data) {
+		return i.fail("Truncated field")
+	}
+	i.value, i.data = i.data[:n], i.data[n:]
+	return true
+}
+
+func (i *FieldIterator) fail(reason string) bool {
+	i.err = fmt.Errorf("Malformed proto: %v after field %d", reason, i.number)
+	i.data, i.value = nil, nil
+	return false
+}
+
+// Number returns the field number of the current field.
+func (i *FieldIterator) Number() int32 { return i.number }
+
+// WireType returns the wire type of the current field.
+func (i *FieldIterator) WireType() int { return i.wireType }
+
+// Bytes returns the encoded value of the current field. For length-delimited
+// fields the length prefix is not included.
+// The returned slice may be shared with the database and must not be modified.
+func (i *FieldIterator) Bytes() []byte { return i.value }
+
+// Decode decodes the current field, which must be a length-delimited message
+// field, into m.
+func (i *FieldIterator) Decode(m proto.Message) error {
+	if i.wireType != proto.WireBytes {
+		return fmt.Errorf("Field %d is not length-delimited", i.number)
+	}
+	return proto.Unmarshal(i.value, m)
+}
+
+// Err returns the error that stopped the iteration, or nil if the iteration
+// has not stopped or reached the end of the message.
+func (i *FieldIterator) Err() error { return i.err }
+
+// Implements rawResolver
+func (d *memory) resolveRaw(ctx context.Context, id id.ID) ([]byte, error) {
+	d.mutex.Lock()
+	_, r, err := d.lookupLocked(ctx, id)
+	if err == nil && !r.resolvable {
+		// The stored proto is the value. Encode it, migrated to its latest
+		// schema version, once and reuse the bytes for later calls.
+		encoded, stored := r.encoded, r.proto
+		d.mutex.Unlock()
+		if encoded != nil {
+			return encoded, nil
+		}
+		msg, err := migrate(ctx, stored)
+		if err != nil {
+			return nil, err
+		}
+		data, err := proto.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		if r.encoded == nil {
+			r.encoded = data
+			d.resizeLocked(r)
+		}
+		return r.encoded, nil
+	}
+	d.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	v, err := d.resolve(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return marshalValue(ctx, v)
+}
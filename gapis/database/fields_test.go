@@ -0,0 +1,100 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+var subtreeDecodes int
+
+// subtree is a message that counts the number of times it is decoded.
+type subtree struct {
+	Data []byte `protobuf:"bytes,1,opt,name=data"`
+}
+
+func (m *subtree) Reset()         { *m = subtree{} }
+func (m *subtree) String() string { return proto.CompactTextString(m) }
+func (*subtree) ProtoMessage()    {}
+
+func (m *subtree) Unmarshal(data []byte) error {
+	subtreeDecodes++
+	b := proto.NewBuffer(data)
+	if _, err := b.DecodeVarint(); err != nil { // key
+		return err
+	}
+	d, err := b.DecodeRawBytes(true)
+	m.Data = d
+	return err
+}
+
+type tree struct {
+	Version uint32   `protobuf:"varint,1,opt,name=version"`
+	Left    *subtree `protobuf:"bytes,2,opt,name=left"`
+	Middle  *subtree `protobuf:"bytes,3,opt,name=middle"`
+	Right   *subtree `protobuf:"bytes,4,opt,name=right"`
+}
+
+func (m *tree) Reset()         { *m = tree{} }
+func (m *tree) String() string { return proto.CompactTextString(m) }
+func (*tree) ProtoMessage()    {}
+
+func TestResolveFields(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	large := func(b byte) *subtree { return &subtree{Data: bytes.Repeat([]byte{b}, 1<<16)} }
+	i, err := database.Store(ctx, &tree{Version: 3, Left: large('l'), Middle: large('m'), Right: large('r')})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+
+	it, err := database.ResolveFields(ctx, i)
+	assert.For(ctx, "ResolveFields").ThatError(err).Succeeded()
+	subtreeDecodes = 0
+	numbers := []int32{}
+	var middle subtree
+	for it.Next() {
+		numbers = append(numbers, it.Number())
+		if it.Number() == 3 {
+			assert.For(ctx, "Decode").ThatError(it.Decode(&middle)).Succeeded()
+		}
+	}
+	assert.For(ctx, "Err").ThatError(it.Err()).Succeeded()
+	assert.For(ctx, "Fields").ThatSlice(numbers).Equals([]int32{1, 2, 3, 4})
+	assert.For(ctx, "Decodes").That(subtreeDecodes).Equals(1)
+	assert.For(ctx, "Middle").That(bytes.Equal(middle.Data, large('m').Data)).Equals(true)
+}
+
+func TestResolveFieldsReusesEncoding(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	i, err := database.Store(ctx, &tree{Version: 3, Left: &subtree{Data: []byte("left")}})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+
+	first := func() []byte {
+		it, err := database.ResolveFields(ctx, i)
+		assert.For(ctx, "ResolveFields").ThatError(err).Succeeded()
+		assert.For(ctx, "Next").That(it.Next()).Equals(true)
+		return it.Bytes()
+	}
+	a, b := first(), first()
+	assert.For(ctx, "Shared encoding").That(&a[0] == &b[0]).Equals(true)
+}
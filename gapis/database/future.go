@@ -0,0 +1,64 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/event/task"
+)
+
+// Future is the pending result of a resolve started with ResolveFuture.
+type Future struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+// ResolveFuture starts resolving id with the database held by the context,
+// returning a Future that can be used to wait for the result.
+// Futures of the same id share the single resolve of the database.
+// Cancelling ctx cancels the resolve if nothing else is waiting on it.
+func ResolveFuture(ctx context.Context, id id.ID) *Future {
+	f := &Future{done: make(chan struct{})}
+	if fn := overrideFor(ctx, id); fn != nil {
+		go func() {
+			f.val, f.err = fn(ctx)
+			close(f.done)
+		}()
+		return f
+	}
+	d := Get(ctx)
+	go func() {
+		f.val, f.err = d.resolve(ctx, id)
+		close(f.done)
+	}()
+	return f
+}
+
+// Done returns a channel that is closed once the resolve has finished.
+func (f *Future) Done() <-chan struct{} { return f.done }
+
+// Await blocks until the resolve has finished or ctx is cancelled, returning
+// the resolved value.
+func (f *Future) Await(ctx context.Context) (interface{}, error) {
+	select {
+	case <-f.done:
+		return f.val, f.err
+	case <-task.ShouldStop(ctx):
+		return nil, task.StopReason(ctx)
+	}
+}
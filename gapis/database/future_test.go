@@ -0,0 +1,62 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestResolveFuture(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	calls := int32(0)
+	release := make(chan struct{})
+	i, err := database.Store(ctx, newResolvable("future", func(context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "resolved", nil
+	}))
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+
+	futures := []*database.Future{database.ResolveFuture(ctx, i), database.ResolveFuture(ctx, i)}
+	select {
+	case <-futures[0].Done():
+		assert.For(ctx, "Done").Error("Future finished before resolve was released")
+	default:
+	}
+
+	wg := sync.WaitGroup{}
+	for n := 0; n < 8; n++ {
+		f := futures[n%len(futures)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := f.Await(ctx)
+			assert.For(ctx, "Await").ThatError(err).Succeeded()
+			assert.For(ctx, "Value").That(got).Equals("resolved")
+		}()
+	}
+	close(release)
+	wg.Wait()
+	assert.For(ctx, "Resolve calls").That(atomic.LoadInt32(&calls)).Equals(int32(1))
+}
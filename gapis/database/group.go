@@ -0,0 +1,49 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/event/task"
+)
+
+// ResolveGroup is a set of resolves that can be cancelled together, without
+// cancelling the context they were started from.
+type ResolveGroup struct {
+	ctx    context.Context
+	cancel task.CancelFunc
+}
+
+// NewResolveGroup returns a new ResolveGroup for resolves with the database
+// held by the context, along with the group's context. Resolves started with
+// the group's context belong to the group.
+func NewResolveGroup(ctx context.Context) (*ResolveGroup, context.Context) {
+	ctx, cancel := task.WithCancel(ctx)
+	return &ResolveGroup{ctx: ctx, cancel: cancel}, ctx
+}
+
+// Resolve resolves id as part of the group.
+func (g *ResolveGroup) Resolve(id id.ID) (interface{}, error) {
+	return Resolve(g.ctx, id)
+}
+
+// Cancel stops the group's callers waiting on their resolves. As resolves are
+// shared, a resolve only stops once all its callers have stopped waiting, so
+// a resolve that another group is waiting on continues for that group.
+func (g *ResolveGroup) Cancel() {
+	g.cancel()
+}
@@ -0,0 +1,73 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestResolveGroup(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	started, gate, calls := make(chan struct{}), make(chan struct{}), 0
+	i, err := database.Store(ctx, newResolvable("group", func(ctx context.Context) (interface{}, error) {
+		calls++
+		close(started)
+		select {
+		case <-gate:
+			return "done", nil
+		case <-task.ShouldStop(ctx):
+			return nil, task.StopReason(ctx)
+		}
+	}))
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+
+	type result struct {
+		v   interface{}
+		err error
+	}
+	resolve := func(g *database.ResolveGroup) <-chan result {
+		c := make(chan result, 1)
+		go func() {
+			v, err := g.Resolve(i)
+			c <- result{v, err}
+		}()
+		return c
+	}
+
+	kept, _ := database.NewResolveGroup(ctx)
+	cancelled, _ := database.NewResolveGroup(ctx)
+	keptResult := resolve(kept)
+	<-started
+	cancelledResult := resolve(cancelled)
+
+	cancelled.Cancel()
+	got := <-cancelledResult
+	assert.For(ctx, "Cancelled group").ThatError(got.err).Failed()
+
+	close(gate)
+	got = <-keptResult
+	assert.For(ctx, "Kept group").ThatError(got.err).Succeeded()
+	assert.For(ctx, "Kept value").That(got.v).Equals("done")
+	assert.For(ctx, "Calls").That(calls).Equals(1)
+	assert.For(ctx, "Parent context").ThatError(task.StopReason(ctx)).Succeeded()
+}
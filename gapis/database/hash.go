@@ -17,11 +17,13 @@ package database
 import (
 	"context"
 	"crypto/sha1"
+	"encoding/binary"
 	"hash"
 	"reflect"
 	"sync"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/context/keys"
 	"github.com/google/gapid/core/data/id"
 )
 
@@ -37,17 +39,23 @@ var (
 // Objects with a graph structure are allowed.
 // Only members that would be encoded using a binary.Encoder are considered.
 func Hash(ctx context.Context, val interface{}) (id.ID, error) {
+	val = canonicalize(val)
 	msg, err := toProto(ctx, val)
 	if err != nil {
 		return id.ID{}, nil
 	}
-	return hashProto(val, msg)
+	return hashProto(val, normalizeFor(ctx, msg))
 }
 
 func hashProto(val interface{}, msg proto.Message) (id.ID, error) {
+	return hashTyped(reflect.TypeOf(val), msg)
+}
+
+// hashTyped returns the id of msg converted from a value of type ty.
+func hashTyped(ty reflect.Type, msg proto.Message) (id.ID, error) {
 	h := sha1Pool.Get().(hash.Hash)
 	h.Reset()
-	h.Write([]byte(reflect.TypeOf(val).String()))
+	h.Write([]byte(ty.String()))
 
 	buf := protobufPool.Get().(*proto.Buffer)
 	buf.Reset()
@@ -65,3 +73,34 @@ func hashProto(val interface{}, msg proto.Message) (id.ID, error) {
 	}
 	return out, nil
 }
+
+// DerivedID returns an id for a value derived from the values with the ids
+// inputs, distinguished by tag. The id depends on the order of inputs, and is
+// stable across processes, so derived values can be content-addressed by
+// their inputs before they are built.
+func DerivedID(inputs []id.ID, tag string) id.ID {
+	size := make([]byte, binary.MaxVarintLen64)
+	data := [][]byte{size[:binary.PutUvarint(size, uint64(len(tag)))], []byte(tag)}
+	for i := range inputs {
+		data = append(data, inputs[i][:])
+	}
+	return id.OfBytes(data...)
+}
+
+type derivedKeyTy string
+
+const derivedKey = derivedKeyTy("derivedID")
+
+// withDerivedID returns a context that marks the values stored with it as
+// stored under an id that is not the hash of the value, such as an id built
+// with DerivedID. Verify does not check the ids of these values.
+func withDerivedID(ctx context.Context) context.Context {
+	return keys.WithValue(ctx, derivedKey, true)
+}
+
+// isDerivedID returns true if the values stored with ctx are stored under an
+// id that is not the hash of the value.
+func isDerivedID(ctx context.Context) bool {
+	derived, _ := ctx.Value(derivedKey).(bool)
+	return derived
+}
@@ -0,0 +1,48 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestDerivedID(t *testing.T) {
+	ctx := log.Testing(t)
+	a, b := id.OfString("a"), id.OfString("b")
+
+	derived := database.DerivedID([]id.ID{a, b}, "merge")
+	assert.For(ctx, "Valid").That(derived.IsValid()).Equals(true)
+	assert.For(ctx, "Stable").That(database.DerivedID([]id.ID{a, b}, "merge")).Equals(derived)
+	assert.For(ctx, "Known value").That(derived.String()).Equals(
+		id.OfBytes([]byte{5}, []byte("merge"), a[:], b[:]).String())
+
+	for _, test := range []struct {
+		name   string
+		inputs []id.ID
+		tag    string
+	}{
+		{"Different tag", []id.ID{a, b}, "concat"},
+		{"Different order", []id.ID{b, a}, "merge"},
+		{"Fewer inputs", []id.ID{a}, "merge"},
+		{"Tag and input boundary", []id.ID{a, b}, "merg"},
+	} {
+		assert.For(ctx, test.name).That(database.DerivedID(test.inputs, test.tag) != derived).Equals(true)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/gapid/core/data/id"
+)
+
+// InFlightResolve describes a resolve that has not yet finished.
+type InFlightResolve struct {
+	// ID is the identifier of the resolving record.
+	ID id.ID
+	// Type is the name of the type being resolved.
+	Type string
+	// Started is the time the resolve started.
+	Started time.Time
+	// Elapsed is how long the resolve had been running when InFlight was
+	// called.
+	Elapsed time.Duration
+}
+
+// inFlightLister is the interface implemented by databases that can list
+// their unfinished resolves.
+type inFlightLister interface {
+	inFlightResolves() []InFlightResolve
+}
+
+// InFlight returns a snapshot of the resolves currently running in the
+// database held by the context, longest running first.
+// Databases that do not track their resolves return an empty list.
+func InFlight(ctx context.Context) []InFlightResolve {
+	l, ok := Get(ctx).(inFlightLister)
+	if !ok {
+		return nil
+	}
+	out := l.inFlightResolves()
+	now := time.Now()
+	for i := range out {
+		out[i].Elapsed = now.Sub(out[i].Started)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Started.Before(out[j].Started) })
+	return out
+}
+
+// Implements inFlightLister
+func (d *memory) inFlightResolves() []InFlightResolve {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	out := make([]InFlightResolve, 0, len(d.inFlight))
+	for id, rs := range d.inFlight {
+		out = append(out, InFlightResolve{ID: id, Type: rs.typename, Started: rs.started})
+	}
+	return out
+}
+
+// removeInFlightLocked removes rs from the list of unfinished resolves.
+// removeInFlightLocked must be called with a locked mutex.
+func (d *memory) removeInFlightLocked(id id.ID, rs *resolveState) {
+	if d.inFlight[id] == rs {
+		delete(d.inFlight, id)
+	}
+}
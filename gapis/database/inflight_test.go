@@ -0,0 +1,50 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestInFlight(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	started, release := make(chan struct{}), make(chan struct{})
+	i, err := database.Store(ctx, newResolvable("in-flight", func(context.Context) (interface{}, error) {
+		close(started)
+		<-release
+		return "done", nil
+	}))
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	assert.For(ctx, "Before resolve").That(len(database.InFlight(ctx))).Equals(0)
+
+	f := database.ResolveFuture(ctx, i)
+	<-started
+	inFlight := database.InFlight(ctx)
+	assert.For(ctx, "During resolve").That(len(inFlight)).Equals(1)
+	assert.For(ctx, "ID").That(inFlight[0].ID).Equals(i)
+	assert.For(ctx, "Type").That(inFlight[0].Type).Equals("*database_test.testResolvable")
+
+	close(release)
+	_, err = f.Await(ctx)
+	assert.For(ctx, "Await").ThatError(err).Succeeded()
+	assert.For(ctx, "After resolve").That(len(database.InFlight(ctx))).Equals(0)
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/google/gapid/core/data/id"
@@ -27,11 +28,22 @@ import (
 	"github.com/google/gapid/gapis/config"
 )
 
+// Option is a configuration option for a database built with NewInMemory.
+type Option func(*memory)
+
 // NewInMemory builds a new in memory database.
-func NewInMemory(ctx context.Context) Database {
+func NewInMemory(ctx context.Context, opts ...Option) Database {
 	m := &memory{}
 	m.records = map[id.ID]*record{}
+	m.computing = map[id.ID]*computation{}
+	m.inFlight = map[id.ID]*resolveState{}
+	m.subscribers = map[id.ID][]*subscription{}
+	m.refs = map[string]id.ID{}
+	m.aliases = map[id.ID]id.ID{}
 	m.resolveCtx = Put(ctx, m)
+	for _, o := range opts {
+		o(m)
+	}
 	return m
 }
 
@@ -40,6 +52,21 @@ type record struct {
 	object       interface{}
 	resolveState *resolveState
 	created      callstack
+	stored       time.Time    // Time the record was stored
+	resolvable   bool         // True if the stored value was resolvable
+	resolved     bool         // True if the record has been resolved
+	params       []param      // Context values for the resolve of a partition
+	partition    bool         // True if the record is a partition of a ParamsResolvable
+	recomputable bool         // True if object was built by a Resolvable
+	generation   uint64       // The database generation of the last resolve
+	size         uint64       // The accounted size of the record in bytes
+	builtSize    uint64       // The accounted size of the record's built value in bytes
+	encoded      []byte       // Cached encoding of the stored proto, built by resolveRaw
+	pins         int          // Number of snapshots holding the built value
+	storedType   reflect.Type // Type of the value the id was hashed from
+	hits         uint64       // Number of resolves of the record's built values
+	expires      time.Time    // Time the record is dropped. Zero means never. See StoreWithExpiry.
+	derived      bool         // True if the id is not the hash of the stored proto
 }
 
 type resolveState struct {
@@ -48,48 +75,132 @@ type resolveState struct {
 	finished   chan struct{}   // Signal that resolve has finished. Set to nil when done.
 	waiting    uint32          // Number of go-routines waiting for the resolve
 	cancel     func()          // Cancels ctx
+	started    time.Time       // Time the resolve started
+	typename   string          // Name of the type being resolved
+	value      interface{}     // The resolved value
+	built      time.Time       // Time the resolved value was built
+	expires    time.Time       // Time the resolved value expires. Zero means never.
+	refreshing bool            // True while the value is being rebuilt in the background
+	pending    func()          // Builds the value on the caller's go-routine. See scheduleLocked.
+	digest     id.ID           // Hash of the resolved value when built. See WithVerification.
+	epoch      uint64          // The epoch when the resolve started. See BumpEpoch.
+	volatile   bool            // True if the resolved value expires when the epoch changes
 	callstacks []callstack
 }
 
-func (r *record) resolve(ctx context.Context) error {
+// expired returns true if the resolve has finished and its value has expired.
+func (rs *resolveState) expired(now time.Time) bool {
+	if rs.finished != nil {
+		return false
+	}
+	if rs.volatile && rs.epoch != currentEpoch() {
+		return true
+	}
+	return !rs.expires.IsZero() && !now.Before(rs.expires)
+}
+
+// typename returns the name of the type held by the record.
+func (r *record) typename() string {
+	if r.object != nil {
+		return fmt.Sprintf("%T", r.object)
+	}
+	return fmt.Sprintf("%T", r.proto)
+}
+
+func (r *record) resolve(ctx context.Context) (CachePolicy, error) {
+	policy := DefaultCache
 	// Deserialize the object from the proto if we don't have the object already.
 	if r.object == nil {
-		obj, err := protoconv.ToObject(ctx, r.proto)
+		msg, err := migrate(ctx, r.proto)
+		if err != nil {
+			return policy, err
+		}
+		obj, err := fromProto(ctx, msg)
 		switch err.(type) {
 		case protoconv.ErrNoConverterRegistered:
-			r.object = r.proto
+			r.object = msg
 		case nil:
 			r.object = obj
 		default:
-			return err
+			return policy, err
 		}
 	}
 	for {
+		// If the object controls its caching, then resolve it with its policy.
+		if cc, ok := r.object.(CacheControl); ok {
+			resolved, p, err := cc.ResolveWithPolicy(ctx)
+			if err != nil {
+				return policy, err
+			}
+			r.object, r.recomputable, policy = resolved, true, p
+			continue
+		}
+		// If the object streams its value, then store the stream as chunks.
+		if rr, ok := r.object.(ReaderResolvable); ok {
+			reader, size, err := rr.ResolveReader(ctx)
+			if err != nil {
+				return policy, err
+			}
+			blob, err := storeReader(ctx, reader, size)
+			if err != nil {
+				return policy, err
+			}
+			r.object, r.recomputable = blob, true
+			continue
+		}
 		// If the object implements resolvable, then we need to resolve it.
 		// Is the database value resolvable?
 		resolvable, isResolvable := r.object.(Resolvable)
 		if !isResolvable {
-			return nil
+			return policy, nil
 		}
 		resolved, err := resolvable.Resolve(ctx)
 		if err != nil {
-			return err
+			return policy, err
 		}
-		r.object = resolved
+		r.object, r.recomputable = resolved, true
 	}
 }
 
 type memory struct {
-	mutex      sync.Mutex
-	records    map[id.ID]*record
-	resolveCtx context.Context
+	mutex        sync.Mutex
+	records      map[id.ID]*record
+	computing    map[id.ID]*computation  // In-flight GetOrCompute calls
+	inFlight     map[id.ID]*resolveState // Unfinished resolves
+	resolveCtx   context.Context
+	watchdog     time.Duration // Duration before a resolve is reported as stuck
+	watchdogDump bool          // Include goroutine stacks in watchdog reports
+	staleAfter   time.Duration // Age after which resolved values are refreshed
+	pool         *resolvePool  // Slots for building resolvables. nil means unbounded.
+	subscribers  map[id.ID][]*subscription
+	taps         []*subscription                   // Subscriptions to the events of all entries. See Tap.
+	refs         map[string]id.ID                  // Mutable names for ids, set with Transaction
+	aliases      map[id.ID]id.ID                   // Ids that redirect to other ids, set with Alias
+	verifyBuilt  bool                              // Record digests of built values for Verify
+	copyResolved bool                              // Return copies of values from resolves
+	reconnect    func(context.Context) error       // Called to recover from ErrTransientDevice
+	normalizer   func(proto.Message) proto.Message // Applied to stored protos before hashing
+	dropUnknown  bool                              // Strip unknown fields from stored protos before hashing
+	policy       EvictionPolicy                    // Picks built values to release. nil disables eviction.
+	maxBytes     uint64                            // Size above which built values are released
+	watermark    float64                           // Fraction of maxBytes that built values are released down to
+	costAware    bool                              // Weight the values picked by policy by their size
+	counters     stats                             // Statistics reported by MetricsHandler
+	generation   uint64                            // Incremented each time resolved values are reclaimed
+	size         uint64                            // Sum of the sizes of all the records
+	builtSize    uint64                            // Sum of the sizes of the values built by resolvables
 }
 
 // Implements Database
 func (d *memory) store(ctx context.Context, id id.ID, v interface{}, m proto.Message) error {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
-	return d.storeLocked(ctx, id, v, m)
+	d.dropExpiredLocked(id)
+	if err := d.storeLocked(ctx, id, v, m); err != nil {
+		return err
+	}
+	d.records[id].expires = time.Time{} // Values stored with Store never expire.
+	return nil
 }
 
 // store function must be called with a locked mutex
@@ -99,7 +210,15 @@ func (d *memory) storeLocked(ctx context.Context, id id.ID, v interface{}, m pro
 	}
 	r, got := d.records[id]
 	if !got {
-		d.records[id] = &record{object: v, proto: m, created: getCallstack(4)}
+		r = &record{object: v, proto: m, created: getCallstack(4), stored: time.Now()}
+		if r.storedType = reflect.TypeOf(v); v == nil {
+			r.storedType = reflect.TypeOf(m)
+		}
+		r.resolvable = isResolvable(v) || isResolvable(m)
+		r.derived = isDerivedID(ctx)
+		d.records[id] = r
+		d.resizeLocked(r)
+		d.notifyLocked(id, Stored)
 	} else if config.DebugDatabaseVerify {
 		if !reflect.DeepEqual(m, r.proto) {
 			return fmt.Errorf("Duplicate object id %v", id)
@@ -118,16 +237,40 @@ func (d *memory) resolve(ctx context.Context, id id.ID) (interface{}, error) {
 // resolve function must be called with a locked mutex and returns with a locked
 // mutex.
 func (d *memory) resolveLocked(ctx context.Context, id id.ID) (interface{}, error) {
+	id, err := d.partitionLocked(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r, rs, wait, err := d.beginResolveLocked(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return d.endResolveLocked(ctx, id, r, rs, wait)
+}
+
+// beginResolveLocked starts the resolve of the record with the given id if it
+// is not already resolving. If the resolve has not finished then the caller is
+// registered as waiting on the resolve, and wait is true.
+// beginResolveLocked must be called with a locked mutex, and every successful
+// call must be followed by a call to endResolveLocked.
+func (d *memory) beginResolveLocked(ctx context.Context, id id.ID) (r *record, rs *resolveState, wait bool, err error) {
 	// Look up the record with the provided identifier.
-	r, got := d.records[id]
-	if !got {
+	_, r, err = d.lookupLocked(ctx, id)
+	if err != nil {
 		// Database doesn't recognise this identifier.
-		return nil, fmt.Errorf("Resource '%v' not found", id)
+		return nil, nil, false, err
 	}
 
-	rs := r.resolveState
+	d.pinLocked(ctx, r)
+	rs = r.resolveState
+	if rs != nil && r.pins == 0 && rs.expired(time.Now()) {
+		// The cached value has expired. Rebuild it.
+		d.invalidateLocked(id, r)
+		rs = nil
+	}
 	if rs == nil {
 		// First request for this resolvable.
+		d.counters.misses++
 
 		// Grab the resolve chain from the caller's context.
 		rc := &resolveChain{r, getResolveChain(ctx)}
@@ -135,52 +278,104 @@ func (d *memory) resolveLocked(ctx context.Context, id id.ID) (interface{}, erro
 		// Build a cancellable context for the resolve from database's resolve
 		// context. We use this as we don't to cancel the resolve if a single
 		// caller cancel's their context.
-		resolveCtx, cancel := task.WithCancel(d.resolveCtx)
+		resolveCtx, cancel := task.WithCancel(r.bindParams(d.resolveCtx))
 
 		rs = &resolveState{
 			ctx:      rc.bind(resolveCtx),
 			finished: make(chan struct{}),
 			cancel:   cancel,
+			started:  time.Now(),
+			typename: r.typename(),
+			epoch:    currentEpoch(),
 		}
 		r.resolveState = rs
+		d.inFlight[id] = rs
 
-		// Build the resolvable on a separate go-routine.
-		go func(ctx context.Context) {
+		build := func(ctx context.Context) {
 			defer d.resolvePanicHandler(ctx)
-			err := r.resolve(ctx)
-
-			// Signal that the resolvable has finished.
-			d.mutex.Lock()
-			close(rs.finished)
-			rs.err, rs.finished = err, nil
-			d.mutex.Unlock()
-		}(rs.ctx)
+			if d.watchdog > 0 {
+				defer d.watch(ctx, id, rs.typename)()
+			}
+			policy, err := d.resolveWithTimeout(ctx, r)
+			d.finishResolve(id, r, rs, policy, err)
+		}
+		if t := traceOf(ctx); t != nil {
+			rs.ctx, build = t.bind(rs.ctx), t.traced(id, rs.typename, build)
+		}
+		if d.pool == nil {
+			// Build the resolvable on a separate go-routine.
+			go build(rs.ctx)
+		} else {
+			d.scheduleLocked(id, r, rs, rc, priorityOf(ctx), build)
+		}
+	} else if rs.finished == nil {
+		d.counters.hits++
+		d.tapLocked(id, Hit)
+	} else {
+		d.counters.joins++
 	}
 
-	if finished := rs.finished; finished != nil {
+	if rs.finished != nil {
 		// Buildable has not yet finished.
 		// Increment the waiting go-routine counter.
 		rs.waiting++
-		rs.callstacks = append(rs.callstacks, getCallstack(4))
-		// Wait for either the resolve to finish or ctx to be cancelled.
-		d.mutex.Unlock()
-		select {
-		case <-finished:
-		case <-task.ShouldStop(ctx):
+		rs.callstacks = append(rs.callstacks, getCallstack(5))
+		wait = true
+	}
+	return r, rs, wait, nil
+}
+
+// finishResolve records the result of the resolve rs, and signals that it has
+// finished.
+func (d *memory) finishResolve(id id.ID, r *record, rs *resolveState, policy CachePolicy, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	close(rs.finished)
+	rs.err, rs.finished, rs.value, rs.built = err, nil, r.object, time.Now()
+	rs.expires = policy.expires(rs.built)
+	rs.volatile = policy.volatile || r.partition
+	d.resizeLocked(r)
+	d.removeInFlightLocked(id, rs)
+	d.recordLatencyLocked(rs.built.Sub(rs.started))
+	if err == nil {
+		d.digestLocked(r, rs)
+		d.notifyResolvedLocked(id, r)
+		if d.policy != nil && r.recomputable {
+			d.policy.RecordStore(id, r.size)
+			// Pin the value while evicting, so that a rebuilt value that the
+			// policy has not seen resolved yet is not released before the
+			// callers waiting on it have resolved it.
+			r.pins++
+			d.evictLocked()
+			r.pins--
 		}
-		d.mutex.Lock()
+	}
+}
 
-		// Decrement the waiting go-routine counter.
-		rs.waiting--
-		if rs.waiting == 0 && rs.finished != nil {
-			// There's no more go-routines waiting for this resolvable and it
-			// hasn't finished yet. Cancel it and remove the resolve state from
-			// the record.
-			rs.cancel()
-			r.resolveState = nil
-			d.records[id] = r
+// endResolveLocked waits for the resolve started by beginResolveLocked to
+// finish, and returns the resolved value.
+// endResolveLocked must be called with a locked mutex and returns with a
+// locked mutex.
+func (d *memory) endResolveLocked(ctx context.Context, id id.ID, r *record, rs *resolveState, wait bool) (interface{}, error) {
+	if wait {
+		if run := rs.pending; run != nil {
+			// The resolve is waiting for a caller to build it.
+			rs.pending = nil
+			d.mutex.Unlock()
+			run()
+			d.mutex.Lock()
+		}
+		if finished := rs.finished; finished != nil {
+			// Wait for either the resolve to finish or ctx to be cancelled.
+			d.mutex.Unlock()
+			select {
+			case <-finished:
+			case <-task.ShouldStop(ctx):
+			}
+			d.mutex.Lock()
 		}
 	}
+	d.releaseLocked(id, r, rs, wait)
 
 	if err := task.StopReason(ctx); err != nil {
 		return nil, err // Context was cancelled.
@@ -188,13 +383,71 @@ func (d *memory) resolveLocked(ctx context.Context, id id.ID) (interface{}, erro
 	if rs.err != nil {
 		return nil, rs.err // Resolve errored.
 	}
-	return r.object, nil // Done.
+	r.generation = d.generation
+	r.hits++
+	if d.policy != nil {
+		d.policy.RecordAccess(id)
+	}
+	if d.staleAfter > 0 {
+		d.revalidateLocked(ctx, id, r, rs)
+	}
+	if d.copyResolved {
+		return copyValue(rs.value), nil
+	}
+	return rs.value, nil // Done.
+}
+
+// releaseLocked unregisters a caller that was registered as waiting on rs by
+// beginResolveLocked. If wait is false then releaseLocked does nothing.
+// releaseLocked must be called with a locked mutex.
+func (d *memory) releaseLocked(id id.ID, r *record, rs *resolveState, wait bool) {
+	if !wait {
+		return
+	}
+	// Decrement the waiting go-routine counter.
+	rs.waiting--
+	if rs.waiting == 0 && rs.finished != nil {
+		// There's no more go-routines waiting for this resolvable and it
+		// hasn't finished yet. Cancel it and remove the resolve state from
+		// the record.
+		rs.cancel()
+		r.resolveState = nil
+		d.records[id] = r
+		d.removeInFlightLocked(id, rs)
+	}
+}
+
+// invalidateLocked discards the value built by the record's resolvable so that
+// it is rebuilt on the next resolve.
+// invalidateLocked must be called with a locked mutex.
+func (d *memory) invalidateLocked(id id.ID, r *record) {
+	r.object, r.resolveState, r.recomputable = nil, nil, false
+	d.resizeLocked(r)
+	d.notifyLocked(id, Evicted)
 }
 
 // Implements Database
 func (d *memory) contains(ctx context.Context, id id.ID) (res bool) {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
+	id, err := d.dealiasLocked(ctx, id)
+	if err != nil {
+		return false
+	}
+	d.dropExpiredLocked(id)
 	_, got := d.records[id]
 	return got
 }
+
+// Implements enumerable
+func (d *memory) entries(ctx context.Context) map[id.ID]proto.Message {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	out := make(map[id.ID]proto.Message, len(d.records))
+	for id, r := range d.records {
+		if !r.partition && !d.dropExpiredLocked(id) {
+			out[id] = r.proto
+		}
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/fault"
+)
+
+// ErrNoMetadata is returned by ResolveMeta when the database does not record
+// the metadata of its entries.
+const ErrNoMetadata = fault.Const("Database does not record entry metadata")
+
+// EntryMeta describes how an entry is held by the database.
+type EntryMeta struct {
+	// ProtoType is the name of the proto type the entry is stored as.
+	ProtoType string
+	// StoredBytes is the size of the stored proto in bytes.
+	StoredBytes uint64
+	// IsResolvable is true if the stored value is built by resolving it.
+	IsResolvable bool
+	// StoredAt is the time the entry was stored.
+	StoredAt time.Time
+}
+
+// metaRecorder is the interface implemented by databases that record the
+// metadata of their entries.
+type metaRecorder interface {
+	entryMeta(context.Context, id.ID) (EntryMeta, error)
+}
+
+// ResolveMeta resolves id with the database held by the context, returning the
+// resolved value along with the metadata of the stored entry.
+func ResolveMeta(ctx context.Context, id id.ID) (interface{}, EntryMeta, error) {
+	d := Get(ctx)
+	mr, ok := d.(metaRecorder)
+	if !ok {
+		return nil, EntryMeta{}, ErrNoMetadata
+	}
+	v, err := d.resolve(ctx, id)
+	if err != nil {
+		return nil, EntryMeta{}, err
+	}
+	meta, err := mr.entryMeta(ctx, id)
+	if err != nil {
+		return nil, EntryMeta{}, err
+	}
+	return v, meta, nil
+}
+
+// isResolvable returns true if v is built by the database when resolved.
+func isResolvable(v interface{}) bool {
+	switch v.(type) {
+	case Resolvable, CacheControl, ReaderResolvable:
+		return true
+	}
+	return false
+}
+
+// Implements metaRecorder
+func (d *memory) entryMeta(ctx context.Context, id id.ID) (EntryMeta, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	_, r, err := d.lookupLocked(ctx, id)
+	if err != nil {
+		return EntryMeta{}, err
+	}
+	name := proto.MessageName(r.proto)
+	if name == "" {
+		name = fmt.Sprintf("%T", r.proto)
+	}
+	return EntryMeta{
+		ProtoType:    name,
+		StoredBytes:  uint64(proto.Size(r.proto)),
+		IsResolvable: r.resolvable,
+		StoredAt:     r.stored,
+	}, nil
+}
@@ -0,0 +1,60 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestResolveMeta(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	before := time.Now()
+
+	person := &personV2{First: "Ada", Last: "Lovelace"}
+	p, err := database.Store(ctx, person)
+	assert.For(ctx, "Store person").ThatError(err).Succeeded()
+	r := newResolvable("meta", func(context.Context) (interface{}, error) { return person, nil })
+	i, err := database.Store(ctx, r)
+	assert.For(ctx, "Store resolvable").ThatError(err).Succeeded()
+
+	for _, test := range []struct {
+		name       string
+		id         id.ID
+		stored     proto.Message
+		protoType  string
+		resolvable bool
+	}{
+		{"person", p, person, "database_test.personV2", false},
+		{"resolvable", i, r, "*database_test.testResolvable", true},
+	} {
+		ctx := log.Enter(ctx, test.name)
+		v, meta, err := database.ResolveMeta(ctx, test.id)
+		assert.For(ctx, "ResolveMeta").ThatError(err).Succeeded()
+		assert.For(ctx, "Value").That(v).DeepEquals(person)
+		assert.For(ctx, "ProtoType").That(meta.ProtoType).Equals(test.protoType)
+		assert.For(ctx, "StoredBytes").That(meta.StoredBytes).Equals(uint64(proto.Size(test.stored)))
+		assert.For(ctx, "IsResolvable").That(meta.IsResolvable).Equals(test.resolvable)
+		assert.For(ctx, "StoredAt").That(meta.StoredAt.Before(before)).Equals(false)
+	}
+}
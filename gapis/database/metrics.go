@@ -0,0 +1,120 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the resolve latency histogram.
+var latencyBuckets = []time.Duration{
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+// stats holds the counters reported by MetricsHandler.
+type stats struct {
+	hits         uint64        // Resolves that used an already built value
+	joins        uint64        // Resolves that waited for a value being built by another resolve
+	misses       uint64        // Resolves that started building a value
+	evictions    uint64        // Built values released by reclaim or an eviction policy
+	latency      []uint64      // Finished resolves counted by latencyBuckets, plus +Inf
+	latencySum   time.Duration // Total time spent building values
+	latencyCount uint64        // Number of finished resolves
+	entries      uint64        // Number of records
+	bytes        uint64        // Accounted size of the records
+}
+
+// statsReporter is the interface implemented by databases that can report
+// their cache statistics.
+type statsReporter interface {
+	stats() stats
+}
+
+// MetricsHandler returns a http.Handler that serves the live cache statistics
+// of db in the Prometheus text exposition format. The hit rate is derived from
+// the hit and miss counters. Resolves that join a build started by another
+// resolve are counted as joins, not hits.
+func MetricsHandler(db Database) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sr, ok := db.(statsReporter)
+		if !ok {
+			http.Error(w, "Database does not report metrics", http.StatusNotImplemented)
+			return
+		}
+		s := sr.stats()
+		b := &bytes.Buffer{}
+		metric := func(name, kind, help string, value interface{}) {
+			fmt.Fprintf(b, "# HELP %v %v\n# TYPE %v %v\n%v %v\n", name, help, name, kind, name, value)
+		}
+		metric("gapis_database_resolve_hits_total", "counter",
+			"Resolves that used an already built value.", s.hits)
+		metric("gapis_database_resolve_joins_total", "counter",
+			"Resolves that waited for a value being built by another resolve.", s.joins)
+		metric("gapis_database_resolve_misses_total", "counter",
+			"Resolves that started building a value.", s.misses)
+		metric("gapis_database_evictions_total", "counter",
+			"Built values that were released.", s.evictions)
+		metric("gapis_database_entries", "gauge",
+			"Number of stored entries.", s.entries)
+		metric("gapis_database_bytes", "gauge",
+			"Accounted size of the stored entries in bytes.", s.bytes)
+
+		const latency = "gapis_database_resolve_duration_seconds"
+		fmt.Fprintf(b, "# HELP %v Time taken to build resolved values.\n# TYPE %v histogram\n", latency, latency)
+		cumulative := uint64(0)
+		for i, bound := range latencyBuckets {
+			cumulative += s.latency[i]
+			fmt.Fprintf(b, "%v_bucket{le=\"%v\"} %v\n", latency, bound.Seconds(), cumulative)
+		}
+		fmt.Fprintf(b, "%v_bucket{le=\"+Inf\"} %v\n", latency, s.latencyCount)
+		fmt.Fprintf(b, "%v_sum %v\n%v_count %v\n", latency, s.latencySum.Seconds(), latency, s.latencyCount)
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(b.Bytes())
+	})
+}
+
+// recordLatencyLocked adds a finished resolve that took d to the statistics.
+// recordLatencyLocked must be called with a locked mutex.
+func (d *memory) recordLatencyLocked(duration time.Duration) {
+	if d.counters.latency == nil {
+		d.counters.latency = make([]uint64, len(latencyBuckets)+1)
+	}
+	i := 0
+	for i < len(latencyBuckets) && duration > latencyBuckets[i] {
+		i++
+	}
+	d.counters.latency[i]++
+	d.counters.latencySum += duration
+	d.counters.latencyCount++
+}
+
+// Implements statsReporter
+func (d *memory) stats() stats {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	out := d.counters
+	out.latency = make([]uint64, len(latencyBuckets)+1)
+	copy(out.latency, d.counters.latency)
+	out.entries, out.bytes = uint64(len(d.records)), d.size
+	return out
+}
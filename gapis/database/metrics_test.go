@@ -0,0 +1,112 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	ctx := log.Testing(t)
+	d := database.NewInMemory(ctx)
+	ctx = database.Put(ctx, d)
+
+	a, err := database.Store(ctx, &personV2{First: "Ada"})
+	assert.For(ctx, "Store a").ThatError(err).Succeeded()
+	_, err = database.Store(ctx, &personV2{First: "Alan"})
+	assert.For(ctx, "Store b").ThatError(err).Succeeded()
+	for i := 0; i < 3; i++ {
+		_, err = database.Resolve(ctx, a)
+		assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	}
+	// Expired values are rebuilt, but are not counted as evictions.
+	c, err := database.Store(ctx, &policyResolvable{Policy: "no-cache"})
+	assert.For(ctx, "Store c").ThatError(err).Succeeded()
+	for i := 0; i < 2; i++ {
+		_, err = database.Resolve(ctx, c)
+		assert.For(ctx, "Resolve no-cache").ThatError(err).Succeeded()
+	}
+
+	w := httptest.NewRecorder()
+	database.MetricsHandler(d).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.For(ctx, "Status").That(w.Code).Equals(http.StatusOK)
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE gapis_database_resolve_hits_total counter",
+		"gapis_database_resolve_hits_total 2",
+		"gapis_database_resolve_misses_total 3",
+		"gapis_database_evictions_total 0",
+		"gapis_database_entries 3",
+		"# TYPE gapis_database_resolve_duration_seconds histogram",
+		`gapis_database_resolve_duration_seconds_bucket{le="+Inf"} 3`,
+		"gapis_database_resolve_duration_seconds_count 3",
+	} {
+		assert.For(ctx, "Has %q", line).That(strings.Contains(body, line+"\n")).Equals(true)
+	}
+	assert.For(ctx, "Has bytes").That(strings.Contains(body, "\ngapis_database_bytes ")).Equals(true)
+	assert.For(ctx, "Zero bytes").That(strings.Contains(body, "\ngapis_database_bytes 0\n")).Equals(false)
+}
+
+func TestMetricsJoins(t *testing.T) {
+	ctx := log.Testing(t)
+	d := database.NewInMemory(ctx)
+	ctx = database.Put(ctx, d)
+
+	release := make(chan struct{})
+	i, err := database.Store(ctx, newResolvable("metrics-join", func(context.Context) (interface{}, error) {
+		<-release
+		return "built", nil
+	}))
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	metrics := func() string {
+		w := httptest.NewRecorder()
+		database.MetricsHandler(d).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		return w.Body.String()
+	}
+
+	// The second resolve joins the build started by the first.
+	done := make(chan error, 2)
+	for n := 0; n < 2; n++ {
+		go func() {
+			_, err := database.Resolve(ctx, i)
+			done <- err
+		}()
+	}
+	for !strings.Contains(metrics(), "gapis_database_resolve_joins_total 1\n") {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	for n := 0; n < 2; n++ {
+		assert.For(ctx, "Resolve").ThatError(<-done).Succeeded()
+	}
+
+	body := metrics()
+	for _, line := range []string{
+		"gapis_database_resolve_hits_total 0",
+		"gapis_database_resolve_joins_total 1",
+		"gapis_database_resolve_misses_total 1",
+	} {
+		assert.For(ctx, "Has %q", line).That(strings.Contains(body, line+"\n")).Equals(true)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/log"
+)
+
+// Migrator converts a stored message of an old schema version to the message
+// type of the next version.
+type Migrator func(ctx context.Context, old proto.Message) (proto.Message, error)
+
+var (
+	migratorsMutex sync.RWMutex
+	migrators      = map[reflect.Type]Migrator{}
+)
+
+// RegisterMigrator registers m as the function used to convert stored messages
+// of oldType when they are resolved. Each schema version is a distinct proto
+// type, and migrators are chained, so a message of the oldest version is
+// migrated through every later version before it is returned.
+func RegisterMigrator(oldType reflect.Type, m Migrator) {
+	migratorsMutex.Lock()
+	defer migratorsMutex.Unlock()
+	migrators[oldType] = m
+}
+
+// migrate returns msg converted to its latest schema version using the
+// registered migrators.
+func migrate(ctx context.Context, msg proto.Message) (proto.Message, error) {
+	seen := map[reflect.Type]bool{}
+	for {
+		ty := reflect.TypeOf(msg)
+		migratorsMutex.RLock()
+		m, ok := migrators[ty]
+		migratorsMutex.RUnlock()
+		if !ok {
+			return msg, nil
+		}
+		if seen[ty] {
+			return nil, fmt.Errorf("Migrators for %v form a loop", ty)
+		}
+		seen[ty] = true
+		out, err := m(ctx, msg)
+		if err != nil {
+			return nil, log.Errf(ctx, err, "Failed to migrate %v", ty)
+		}
+		msg = out
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+type addressV1 struct {
+	Line string `protobuf:"bytes,1,opt,name=line"`
+}
+
+func (m *addressV1) Reset()         { *m = addressV1{} }
+func (m *addressV1) String() string { return proto.CompactTextString(m) }
+func (*addressV1) ProtoMessage()    {}
+
+type addressV2 struct {
+	Street string `protobuf:"bytes,1,opt,name=street"`
+	City   string `protobuf:"bytes,2,opt,name=city"`
+}
+
+func (m *addressV2) Reset()         { *m = addressV2{} }
+func (m *addressV2) String() string { return proto.CompactTextString(m) }
+func (*addressV2) ProtoMessage()    {}
+
+func init() {
+	database.RegisterMigrator(reflect.TypeOf(&addressV1{}), func(ctx context.Context, old proto.Message) (proto.Message, error) {
+		parts := strings.SplitN(old.(*addressV1).Line, ", ", 2)
+		return &addressV2{Street: parts[0], City: parts[1]}, nil
+	})
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	i, err := database.Store(ctx, &addressV1{Line: "1 Main St, Springfield"})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	got, err := database.Resolve(ctx, i)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	assert.For(ctx, "Migrated").That(got).DeepEquals(&addressV2{Street: "1 Main St", City: "Springfield"})
+
+	// Current messages are untouched.
+	current := &addressV2{Street: "2 High St", City: "Shelbyville"}
+	i, err = database.Store(ctx, current)
+	assert.For(ctx, "Store current").ThatError(err).Succeeded()
+	got, err = database.Resolve(ctx, i)
+	assert.For(ctx, "Resolve current").ThatError(err).Succeeded()
+	assert.For(ctx, "Current").That(got).DeepEquals(current)
+}
+
+func TestMigratorResolveFields(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	i, err := database.Store(ctx, &addressV1{Line: "1 Main St, Springfield"})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	for j := 0; j < 2; j++ {
+		it, err := database.ResolveFields(ctx, i)
+		assert.For(ctx, "ResolveFields").ThatError(err).Succeeded()
+		fields := map[int32]string{}
+		for it.Next() {
+			fields[it.Number()] = string(it.Bytes())
+		}
+		assert.For(ctx, "Err").ThatError(it.Err()).Succeeded()
+		assert.For(ctx, "Migrated fields").That(fields).DeepEquals(map[int32]string{1: "1 Main St", 2: "Springfield"})
+	}
+}
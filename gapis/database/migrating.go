@@ -0,0 +1,132 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+)
+
+// MigrationMode is the stage of a migration between two databases.
+type MigrationMode int
+
+const (
+	// ReadOldWriteBoth serves resolves from the old database, and stores to
+	// both. Failures to store to the new database are logged, but do not fail
+	// the store.
+	ReadOldWriteBoth = MigrationMode(iota)
+	// ReadNewWriteBoth serves resolves from the new database, falling back to
+	// the old database for ids the new database fails to resolve, and stores
+	// to both.
+	ReadNewWriteBoth
+	// NewOnly serves resolves from, and stores to, the new database.
+	NewOnly
+)
+
+// MigrationStats holds the read statistics of a migrating database.
+type MigrationStats struct {
+	// Resolves is the number of resolves made to the database.
+	Resolves uint64
+	// Fallbacks is the number of resolves served by the old database because
+	// the new database failed to resolve them. Fallbacks that stay above zero
+	// show that the new database is still missing entries.
+	Fallbacks uint64
+}
+
+// NewMigratingDatabase returns a Database that routes its operations between
+// the old and new databases of a migration as set by mode.
+func NewMigratingDatabase(old, new Database, mode MigrationMode) Database {
+	return &migrating{old: old, new: new, mode: mode}
+}
+
+// GetMigrationStats returns the read statistics of db, or false if db was not
+// built with NewMigratingDatabase.
+func GetMigrationStats(db Database) (MigrationStats, bool) {
+	m, ok := db.(*migrating)
+	if !ok {
+		return MigrationStats{}, false
+	}
+	return MigrationStats{
+		Resolves:  atomic.LoadUint64(&m.resolves),
+		Fallbacks: atomic.LoadUint64(&m.fallbacks),
+	}, true
+}
+
+type migrating struct {
+	old       Database
+	new       Database
+	mode      MigrationMode
+	resolves  uint64 // Accessed atomically
+	fallbacks uint64 // Accessed atomically
+}
+
+// Implements Database
+func (d *migrating) store(ctx context.Context, id id.ID, v interface{}, m proto.Message) error {
+	switch d.mode {
+	case ReadOldWriteBoth:
+		if err := d.old.store(ctx, id, v, m); err != nil {
+			return err
+		}
+		if err := d.new.store(ctx, id, v, m); err != nil {
+			log.W(ctx, "Failed to store %v to the new database: %v", id, err)
+		}
+		return nil
+	case ReadNewWriteBoth:
+		if err := d.old.store(ctx, id, v, m); err != nil {
+			return err
+		}
+	}
+	return d.new.store(ctx, id, v, m)
+}
+
+// Implements Database
+func (d *migrating) resolve(ctx context.Context, id id.ID) (interface{}, error) {
+	atomic.AddUint64(&d.resolves, 1)
+	switch d.mode {
+	case ReadOldWriteBoth:
+		return d.old.resolve(ctx, id)
+	case ReadNewWriteBoth:
+		out, err := d.new.resolve(ctx, id)
+		if err == nil || !d.old.contains(ctx, id) {
+			return out, err
+		}
+		atomic.AddUint64(&d.fallbacks, 1)
+		return d.old.resolve(ctx, id)
+	}
+	return d.new.resolve(ctx, id)
+}
+
+// Implements Database
+func (d *migrating) contains(ctx context.Context, id id.ID) bool {
+	switch d.mode {
+	case ReadOldWriteBoth:
+		return d.old.contains(ctx, id)
+	case ReadNewWriteBoth:
+		return d.new.contains(ctx, id) || d.old.contains(ctx, id)
+	}
+	return d.new.contains(ctx, id)
+}
+
+// Implements normalizer
+func (d *migrating) normalize(m proto.Message) proto.Message {
+	if d.mode == ReadOldWriteBoth {
+		return normalizeWith(d.old, m)
+	}
+	return normalizeWith(d.new, m)
+}
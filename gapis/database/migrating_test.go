@@ -0,0 +1,69 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestMigratingDatabase(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, test := range []struct {
+		name      string
+		mode      database.MigrationMode
+		inOld     bool // Store is written to old
+		inNew     bool // Store is written to new
+		oldOnly   bool // Entry only in old is resolvable
+		newOnly   bool // Entry only in new is resolvable
+		fallbacks uint64
+	}{
+		{"ReadOldWriteBoth", database.ReadOldWriteBoth, true, true, true, false, 0},
+		{"ReadNewWriteBoth", database.ReadNewWriteBoth, true, true, true, true, 1},
+		{"NewOnly", database.NewOnly, false, true, false, true, 0},
+	} {
+		ctx := log.Enter(ctx, test.name)
+		old, new := database.NewInMemory(ctx), database.NewInMemory(ctx)
+		oldCtx, newCtx := database.Put(ctx, old), database.Put(ctx, new)
+		db := database.NewMigratingDatabase(old, new, test.mode)
+		dbCtx := database.Put(ctx, db)
+
+		stored, err := database.Store(dbCtx, &personV2{First: "Both"})
+		assert.For(ctx, "Store").ThatError(err).Succeeded()
+		resolvable := func(ctx context.Context, i id.ID) bool {
+			_, err := database.Resolve(ctx, i)
+			return err == nil
+		}
+		assert.For(ctx, "Written to old").That(resolvable(oldCtx, stored)).Equals(test.inOld)
+		assert.For(ctx, "Written to new").That(resolvable(newCtx, stored)).Equals(test.inNew)
+
+		oldOnly, err := database.Store(oldCtx, &personV2{First: "Old"})
+		assert.For(ctx, "Store old").ThatError(err).Succeeded()
+		newOnly, err := database.Store(newCtx, &personV2{First: "New"})
+		assert.For(ctx, "Store new").ThatError(err).Succeeded()
+		assert.For(ctx, "Reads old").That(resolvable(dbCtx, oldOnly)).Equals(test.oldOnly)
+		assert.For(ctx, "Reads new").That(resolvable(dbCtx, newOnly)).Equals(test.newOnly)
+
+		stats, ok := database.GetMigrationStats(db)
+		assert.For(ctx, "GetMigrationStats").That(ok).Equals(true)
+		assert.For(ctx, "Resolves").That(stats.Resolves).Equals(uint64(2))
+		assert.For(ctx, "Fallbacks").That(stats.Fallbacks).Equals(test.fallbacks)
+	}
+}
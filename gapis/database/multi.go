@@ -0,0 +1,96 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/gapid/core/data/id"
+)
+
+// MultiResolvable is the interface for types that, like Resolvable, lazily
+// build values, but that build several named outputs with a single build.
+// Each output is stored under its own id, given by OutputID, so that it can
+// be referenced and resolved on its own.
+type MultiResolvable interface {
+	// ResolveMulti constructs and returns the lazily-built outputs by name.
+	ResolveMulti(ctx context.Context) (map[string]interface{}, error)
+}
+
+// OutputID returns the id of the output with the given name of the
+// MultiResolvable with the id parent.
+// Output ids are derived from the parent id and the output name with
+// DerivedID, not from the value of the output, so they are known before the
+// outputs are built, and are stable across runs and processes. Outputs with
+// equal values, such as two empty outputs, still have different ids.
+func OutputID(parent id.ID, name string) id.ID {
+	return DerivedID([]id.ID{parent}, "output:"+name)
+}
+
+// ResolveOutputs builds the outputs of the MultiResolvable with the id parent
+// using the database held by the context, returning the id of each output by
+// name. The outputs are only built the first time they are needed, and
+// concurrent callers share a single build. The values of the outputs must be
+// non-nil and convertible to a proto so they can be stored.
+func ResolveOutputs(ctx context.Context, parent id.ID) (map[string]id.ID, error) {
+	manifest, err := GetOrCompute(ctx, DerivedID([]id.ID{parent}, "outputs"), func(ctx context.Context) (interface{}, error) {
+		return storeOutputs(ctx, parent)
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]id.ID{}
+	for _, name := range manifest.(*MultiOutputs).Names {
+		out[name] = OutputID(parent, name)
+	}
+	return out, nil
+}
+
+// storeOutputs builds the outputs of the MultiResolvable with the id parent
+// and stores each of them under its OutputID, returning the manifest of the
+// outputs.
+func storeOutputs(ctx context.Context, parent id.ID) (*MultiOutputs, error) {
+	v, err := Resolve(ctx, parent)
+	if err != nil {
+		return nil, err
+	}
+	mr, ok := v.(MultiResolvable)
+	if !ok {
+		return nil, fmt.Errorf("Resource '%v' is not a MultiResolvable. Got %T", parent, v)
+	}
+	outputs, err := mr.ResolveMulti(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	d := Get(ctx)
+	for _, name := range names {
+		v := outputs[name]
+		if v == nil {
+			return nil, fmt.Errorf("Output '%v' of '%v' is nil", name, parent)
+		}
+		compute := func(context.Context) (interface{}, error) { return v, nil }
+		if err := storeComputed(ctx, d.store, OutputID(parent, name), compute); err != nil {
+			return nil, err
+		}
+	}
+	return &MultiOutputs{Names: names}, nil
+}
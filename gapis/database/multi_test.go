@@ -0,0 +1,72 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+// splitResolvable splits a name into its first and last names, either of
+// which can be empty.
+type splitResolvable struct {
+	First string `protobuf:"bytes,1,opt,name=first"`
+	Last  string `protobuf:"bytes,2,opt,name=last"`
+}
+
+func (m *splitResolvable) Reset()         { *m = splitResolvable{} }
+func (m *splitResolvable) String() string { return proto.CompactTextString(m) }
+func (*splitResolvable) ProtoMessage()    {}
+
+func (m *splitResolvable) ResolveMulti(ctx context.Context) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"first": &personV2{First: m.First},
+		"last":  &personV2{Last: m.Last},
+	}, nil
+}
+
+func TestMultiResolvable(t *testing.T) {
+	outputs := func(ctx context.Context) (id.ID, map[string]id.ID) {
+		ctx = database.Put(ctx, database.NewInMemory(ctx))
+		// The last name is empty, so its output is an empty message.
+		parent, err := database.Store(ctx, &splitResolvable{First: "Ada"})
+		assert.For(ctx, "Store").ThatError(err).Succeeded()
+		ids, err := database.ResolveOutputs(ctx, parent)
+		assert.For(ctx, "ResolveOutputs").ThatError(err).Succeeded()
+
+		first, err := database.Resolve(ctx, ids["first"])
+		assert.For(ctx, "Resolve first").ThatError(err).Succeeded()
+		assert.For(ctx, "First").That(first).DeepEquals(&personV2{First: "Ada"})
+		last, err := database.Resolve(ctx, ids["last"])
+		assert.For(ctx, "Resolve last").ThatError(err).Succeeded()
+		assert.For(ctx, "Last").That(last).DeepEquals(&personV2{})
+		return parent, ids
+	}
+
+	ctx := log.Testing(t)
+	parent, a := outputs(log.Enter(ctx, "First database"))
+	_, b := outputs(log.Enter(ctx, "Second database"))
+	assert.For(ctx, "Same ids").That(a).DeepEquals(b)
+	assert.For(ctx, "Output ids").That(a).DeepEquals(map[string]id.ID{
+		"first": database.OutputID(parent, "first"),
+		"last":  database.OutputID(parent, "last"),
+	})
+}
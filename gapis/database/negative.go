@@ -0,0 +1,115 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+)
+
+// WithNegativeCache returns a Database that forwards all operations to d,
+// remembering for ttl the ids that d has confirmed are absent. Resolves of a
+// remembered id fail with ErrNotFound, and contains returns false, without
+// querying d. Storing an id through the returned Database forgets that it was
+// absent. Stores made directly to d are not seen, so can be hidden for up to
+// ttl.
+func WithNegativeCache(d Database, ttl time.Duration) Database {
+	return &negativeCache{inner: d, ttl: ttl, absent: map[id.ID]time.Time{}}
+}
+
+type negativeCache struct {
+	inner  Database
+	ttl    time.Duration
+	mutex  sync.Mutex
+	absent map[id.ID]time.Time // Time each absent id expires from the cache
+	stores uint64              // Incremented by every store
+}
+
+// isAbsent returns true if id is remembered as absent.
+func (d *negativeCache) isAbsent(id id.ID) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	expires, ok := d.absent[id]
+	if ok && !time.Now().Before(expires) {
+		delete(d.absent, id)
+		return false
+	}
+	return ok
+}
+
+// generation returns the number of stores made so far. It is read before
+// querying d.inner so that setAbsent can tell whether a store raced with the
+// query.
+func (d *negativeCache) generation() uint64 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.stores
+}
+
+// setAbsent remembers id as absent, unless a store has been made since gen
+// was read, in which case the absence seen by the caller may be stale.
+func (d *negativeCache) setAbsent(id id.ID, gen uint64) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.stores == gen {
+		d.absent[id] = time.Now().Add(d.ttl)
+	}
+}
+
+// Implements Database
+func (d *negativeCache) store(ctx context.Context, id id.ID, v interface{}, m proto.Message) error {
+	err := d.inner.store(ctx, id, v, m)
+	d.mutex.Lock()
+	d.stores++
+	delete(d.absent, id)
+	d.mutex.Unlock()
+	return err
+}
+
+// Implements Database
+func (d *negativeCache) resolve(ctx context.Context, id id.ID) (interface{}, error) {
+	if d.isAbsent(id) {
+		return nil, log.Errf(ctx, ErrNotFound, "Resource '%v'", id)
+	}
+	gen := d.generation()
+	out, err := d.inner.resolve(ctx, id)
+	if err != nil && !d.inner.contains(ctx, id) {
+		d.setAbsent(id, gen)
+	}
+	return out, err
+}
+
+// Implements Database
+func (d *negativeCache) contains(ctx context.Context, id id.ID) bool {
+	if d.isAbsent(id) {
+		return false
+	}
+	gen := d.generation()
+	found := d.inner.contains(ctx, id)
+	if !found {
+		d.setAbsent(id, gen)
+	}
+	return found
+}
+
+// Implements normalizer
+func (d *negativeCache) normalize(m proto.Message) proto.Message {
+	return normalizeWith(d.inner, m)
+}
@@ -0,0 +1,97 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+	"github.com/pkg/errors"
+)
+
+func TestNegativeCache(t *testing.T) {
+	ctx := log.Testing(t)
+	// Count the operations that reach the inner database by recording them.
+	ops := &bytes.Buffer{}
+	inner := database.NewRecordingDatabase(database.NewInMemory(ctx), ops)
+	ctx = database.Put(ctx, database.WithNegativeCache(inner, time.Hour))
+
+	absent := &personV2{First: "Nobody"}
+	i, err := database.Hash(ctx, absent)
+	assert.For(ctx, "Hash").ThatError(err).Succeeded()
+
+	_, err = database.Resolve(ctx, i)
+	assert.For(ctx, "First resolve").ThatError(err).Failed()
+	queried := ops.Len()
+	assert.For(ctx, "Queried").That(queried > 0).Equals(true)
+
+	_, err = database.Resolve(ctx, i)
+	assert.For(ctx, "Second resolve").That(errors.Cause(err)).Equals(database.ErrNotFound)
+	assert.For(ctx, "Skipped backend").That(ops.Len()).Equals(queried)
+
+	_, err = database.Store(ctx, absent)
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	got, err := database.Resolve(ctx, i)
+	assert.For(ctx, "Resolve stored").ThatError(err).Succeeded()
+	assert.For(ctx, "Value").That(got).DeepEquals(absent)
+}
+
+func TestNegativeCacheExpires(t *testing.T) {
+	ctx := log.Testing(t)
+	inner := database.NewInMemory(ctx)
+	ctx = database.Put(ctx, database.WithNegativeCache(inner, time.Millisecond))
+
+	v := &personV2{First: "Late"}
+	i, err := database.Hash(ctx, v)
+	assert.For(ctx, "Hash").ThatError(err).Succeeded()
+	_, err = database.Resolve(ctx, i)
+	assert.For(ctx, "Resolve absent").ThatError(err).Failed()
+
+	// Store directly to the inner database, which the cache does not see.
+	_, err = database.Store(database.Put(log.Testing(t), inner), v)
+	assert.For(ctx, "Store inner").ThatError(err).Succeeded()
+	time.Sleep(5 * time.Millisecond)
+	_, err = database.Resolve(ctx, i)
+	assert.For(ctx, "Resolve after ttl").ThatError(err).Succeeded()
+}
+
+func TestNegativeCacheConcurrentStore(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.WithNegativeCache(database.NewInMemory(ctx), time.Hour))
+
+	// A lookup that raced with a store must not hide the stored value.
+	for i := 0; i < 100; i++ {
+		v := &personV2{First: fmt.Sprint(i)}
+		h, err := database.Hash(ctx, v)
+		assert.For(ctx, "Hash").ThatError(err).Succeeded()
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			database.Resolve(ctx, h)
+		}()
+		_, err = database.Store(ctx, v)
+		assert.For(ctx, "Store").ThatError(err).Succeeded()
+		wg.Wait()
+		_, err = database.Resolve(ctx, h)
+		assert.For(ctx, "Resolve %d", i).ThatError(err).Succeeded()
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// WithStoreNormalizer returns an Option that passes every stored proto
+// through fn before it is hashed and stored, so that values that only differ
+// in fields that fn clears share an id. fn must return a new message if it
+// changes anything, rather than modifying its argument.
+func WithStoreNormalizer(fn func(proto.Message) proto.Message) Option {
+	return func(m *memory) { m.normalizer = fn }
+}
+
+// WithDropUnknownFields returns an Option that strips the unknown fields from
+// every stored proto before it is hashed and stored, so that messages written
+// by a newer version of a schema share an id with the same logical content
+// written without the newer fields. The stripped fields are lost: resolving
+// the id returns the message without them, so they cannot be passed on to a
+// reader that does understand them. Unknown fields are dropped before any
+// WithStoreNormalizer function is applied.
+func WithDropUnknownFields() Option {
+	return func(m *memory) { m.dropUnknown = true }
+}
+
+// dropUnknownFields returns m without its unknown fields, leaving m unchanged.
+// If m has no unknown fields then m is returned.
+func dropUnknownFields(m proto.Message) proto.Message {
+	out := proto.Clone(m)
+	proto.DiscardUnknown(out)
+	if proto.Size(out) == proto.Size(m) {
+		return m // Nothing was dropped.
+	}
+	return out
+}
+
+// normalizer is the interface implemented by databases that normalize
+// messages before they are hashed.
+type normalizer interface {
+	normalize(proto.Message) proto.Message
+}
+
+// Implements normalizer
+func (d *memory) normalize(m proto.Message) proto.Message {
+	if d.dropUnknown {
+		m = dropUnknownFields(m)
+	}
+	if d.normalizer == nil {
+		return m
+	}
+	return d.normalizer(m)
+}
+
+// normalizeFor returns m normalized by the database held by the context. If
+// the context holds no database, or the database does not normalize messages,
+// then m is returned.
+func normalizeFor(ctx context.Context, m proto.Message) proto.Message {
+	return normalizeWith(lookup(ctx), m)
+}
+
+// normalizeWith returns m normalized by d. If d does not normalize messages
+// then m is returned.
+func normalizeWith(d Database, m proto.Message) proto.Message {
+	if n, ok := d.(normalizer); ok {
+		return n.normalize(m)
+	}
+	return m
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+type stampedPerson struct {
+	Name      string `protobuf:"bytes,1,opt,name=name"`
+	Timestamp int64  `protobuf:"varint,2,opt,name=timestamp"`
+}
+
+func (m *stampedPerson) Reset()         { *m = stampedPerson{} }
+func (m *stampedPerson) String() string { return proto.CompactTextString(m) }
+func (*stampedPerson) ProtoMessage()    {}
+
+func clearTimestamp(m proto.Message) proto.Message {
+	p, ok := m.(*stampedPerson)
+	if !ok || p.Timestamp == 0 {
+		return m
+	}
+	out := *p
+	out.Timestamp = 0
+	return &out
+}
+
+func TestStoreNormalizer(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx, database.WithStoreNormalizer(clearTimestamp)))
+
+	a := &stampedPerson{Name: "Ada", Timestamp: 1}
+	b := &stampedPerson{Name: "Ada", Timestamp: 2}
+	aID, err := database.Store(ctx, a)
+	assert.For(ctx, "Store a").ThatError(err).Succeeded()
+	bID, err := database.Store(ctx, b)
+	assert.For(ctx, "Store b").ThatError(err).Succeeded()
+	assert.For(ctx, "Same id").That(bID).Equals(aID)
+	hashed, err := database.Hash(ctx, b)
+	assert.For(ctx, "Hash").ThatError(err).Succeeded()
+	assert.For(ctx, "Hash id").That(hashed).Equals(aID)
+	assert.For(ctx, "Argument kept").That(a.Timestamp).Equals(int64(1))
+
+	got, err := database.Resolve(ctx, aID)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	assert.For(ctx, "Normalized").That(got).DeepEquals(&stampedPerson{Name: "Ada"})
+
+	c, err := database.Store(ctx, &stampedPerson{Name: "Alan", Timestamp: 1})
+	assert.For(ctx, "Store c").ThatError(err).Succeeded()
+	assert.For(ctx, "Different id").That(c != aID).Equals(true)
+}
+
+func TestStoreNormalizerThroughWrappers(t *testing.T) {
+	ctx := log.Testing(t)
+	inner := database.NewInMemory(ctx, database.WithStoreNormalizer(clearTimestamp))
+	expected, err := database.Hash(database.Put(ctx, inner), &stampedPerson{Name: "Ada"})
+	assert.For(ctx, "Hash").ThatError(err).Succeeded()
+
+	wrapped := database.WithQuota(inner, 1<<20, func(context.Context) string { return "" })
+	pending, attach := database.PutPending(ctx)
+	attach(wrapped)
+
+	for _, test := range []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"Wrapped", database.Put(ctx, wrapped)},
+		{"Pending", pending},
+	} {
+		i, err := database.Store(test.ctx, &stampedPerson{Name: "Ada", Timestamp: 5})
+		assert.For(ctx, "%v store", test.name).ThatError(err).Succeeded()
+		assert.For(ctx, "%v id", test.name).That(i).Equals(expected)
+	}
+
+	// Values stored from inside a resolvable use the inner database.
+	r := newResolvable("normalize-inner", func(ctx context.Context) (interface{}, error) {
+		return database.Store(ctx, &stampedPerson{Name: "Ada", Timestamp: 6})
+	})
+	got, err := database.Build(database.Put(ctx, wrapped), r)
+	assert.For(ctx, "Build").ThatError(err).Succeeded()
+	assert.For(ctx, "Inner id").That(got).Equals(expected)
+
+	src := database.NewInMemory(ctx)
+	_, err = database.Store(database.Put(ctx, src), &stampedPerson{Name: "Ada", Timestamp: 7})
+	assert.For(ctx, "Store src").ThatError(err).Succeeded()
+	remapped, err := database.CopyWithRemap(ctx, inner, src, func(old id.ID, v interface{}) (id.ID, interface{}, error) {
+		return id.ID{}, v, nil
+	})
+	assert.For(ctx, "CopyWithRemap").ThatError(err).Succeeded()
+	assert.For(ctx, "Copied").That(len(remapped)).Equals(1)
+	for _, newID := range remapped {
+		assert.For(ctx, "Copied id").That(newID).Equals(expected)
+	}
+}
+
+// personV3 is personV2 as written by a newer schema, with a middle name.
+type personV3 struct {
+	First  string `protobuf:"bytes,1,opt,name=first"`
+	Last   string `protobuf:"bytes,2,opt,name=last"`
+	Middle string `protobuf:"bytes,3,opt,name=middle"`
+}
+
+func (m *personV3) Reset()         { *m = personV3{} }
+func (m *personV3) String() string { return proto.CompactTextString(m) }
+func (*personV3) ProtoMessage()    {}
+
+// skewedPerson holds the fields of personV2, keeping unknown fields.
+type skewedPerson struct {
+	First            string `protobuf:"bytes,1,opt,name=first"`
+	Last             string `protobuf:"bytes,2,opt,name=last"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *skewedPerson) Reset()         { *m = skewedPerson{} }
+func (m *skewedPerson) String() string { return proto.CompactTextString(m) }
+func (*skewedPerson) ProtoMessage()    {}
+
+func TestDropUnknownFields(t *testing.T) {
+	ctx := log.Testing(t)
+
+	data, err := proto.Marshal(&personV3{First: "Ada", Last: "Lovelace", Middle: "King"})
+	assert.For(ctx, "Marshal").ThatError(err).Succeeded()
+	skewed := &skewedPerson{}
+	assert.For(ctx, "Unmarshal").ThatError(proto.Unmarshal(data, skewed)).Succeeded()
+	assert.For(ctx, "Unknown fields").That(len(skewed.XXX_unrecognized) > 0).Equals(true)
+	plain := &skewedPerson{First: "Ada", Last: "Lovelace"}
+
+	for _, test := range []struct {
+		name string
+		opts []database.Option
+		same bool
+	}{
+		{"Kept", nil, false},
+		{"Dropped", []database.Option{database.WithDropUnknownFields()}, true},
+	} {
+		ctx := log.Enter(ctx, test.name)
+		ctx = database.Put(ctx, database.NewInMemory(ctx, test.opts...))
+		a, err := database.Store(ctx, skewed)
+		assert.For(ctx, "Store skewed").ThatError(err).Succeeded()
+		b, err := database.Store(ctx, plain)
+		assert.For(ctx, "Store plain").ThatError(err).Succeeded()
+		assert.For(ctx, "Same id").That(a == b).Equals(test.same)
+	}
+	assert.For(ctx, "Argument kept").That(len(skewed.XXX_unrecognized) > 0).Equals(true)
+}
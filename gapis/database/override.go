@@ -0,0 +1,58 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/data/id"
+)
+
+type overrideKeyTy string
+
+const overrideKey = overrideKeyTy("resolvableOverride")
+
+// override is a link in the chain of overrides held by a context.
+type override struct {
+	id     id.ID
+	fn     func(context.Context) (interface{}, error)
+	parent *override
+}
+
+// WithResolvableOverride returns a new context where Resolve,
+// ResolveWithPriority, ResolveFuture, ResolveBatch and Build of id call fn
+// instead of resolving id with the database.
+// The database is not consulted, so id does not need to be stored.
+// Overrides only apply to resolves made with the returned context or contexts
+// derived from it. Resolvables built by the database are called with the
+// database's context, so to mock the children of a resolvable, call its
+// Resolve method directly with the returned context.
+func WithResolvableOverride(ctx context.Context, id id.ID, fn func(ctx context.Context) (interface{}, error)) context.Context {
+	parent, _ := ctx.Value(overrideKey).(*override)
+	return keys.WithValue(ctx, overrideKey, &override{id, fn, parent})
+}
+
+// overrideFor returns the function overriding resolves of id with ctx, or nil
+// if resolves of id are not overridden.
+func overrideFor(ctx context.Context, id id.ID) func(context.Context) (interface{}, error) {
+	o, _ := ctx.Value(overrideKey).(*override)
+	for ; o != nil; o = o.parent {
+		if o.id == id {
+			return o.fn
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+// sumResolvable resolves to the sum of its children, which must resolve to
+// ints.
+type sumResolvable struct {
+	Children [][]byte `protobuf:"bytes,1,rep,name=children"`
+}
+
+func (m *sumResolvable) Reset()         { *m = sumResolvable{} }
+func (m *sumResolvable) String() string { return proto.CompactTextString(m) }
+func (*sumResolvable) ProtoMessage()    {}
+
+func (m *sumResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	sum := 0
+	for _, c := range m.Children {
+		child := id.ID{}
+		copy(child[:], c)
+		v, err := database.Resolve(ctx, child)
+		if err != nil {
+			return nil, err
+		}
+		sum += v.(int)
+	}
+	return sum, nil
+}
+
+func ExampleWithResolvableOverride() {
+	ctx := context.Background()
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	// Mock the children of the resolvable under test. Neither is stored in
+	// the database.
+	a, b := id.OfString("a"), id.OfString("b")
+	ctx = database.WithResolvableOverride(ctx, a, func(context.Context) (interface{}, error) { return 2, nil })
+	ctx = database.WithResolvableOverride(ctx, b, func(context.Context) (interface{}, error) { return 3, nil })
+
+	r := &sumResolvable{Children: [][]byte{a[:], b[:]}}
+	sum, err := r.Resolve(ctx)
+	fmt.Println(sum, err)
+	// Output: 5 <nil>
+}
+
+func TestResolvableOverride(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	stored, err := database.Store(ctx, &personV2{First: "Stored"})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	mocked := id.OfString("mocked")
+	ctx = database.WithResolvableOverride(ctx, mocked, func(context.Context) (interface{}, error) { return 7, nil })
+
+	got, err := database.ResolveFuture(ctx, mocked).Await(ctx)
+	assert.For(ctx, "ResolveFuture").ThatError(err).Succeeded()
+	assert.For(ctx, "Future value").That(got).Equals(7)
+
+	batch := database.Batch(ctx)
+	batch.Add(stored)
+	batch.Add(mocked)
+	vals, err := batch.Resolve()
+	assert.For(ctx, "ResolveBatch").ThatError(err).Succeeded()
+	assert.For(ctx, "Batch stored").That(vals[0]).DeepEquals(&personV2{First: "Stored"})
+	assert.For(ctx, "Batch mocked").That(vals[1]).Equals(7)
+
+	r := &sumResolvable{Children: [][]byte{mocked[:]}}
+	built, err := database.Hash(ctx, r)
+	assert.For(ctx, "Hash").ThatError(err).Succeeded()
+	ctx = database.WithResolvableOverride(ctx, built, func(context.Context) (interface{}, error) { return 9, nil })
+	got, err = database.Build(ctx, r)
+	assert.For(ctx, "Build").ThatError(err).Succeeded()
+	assert.For(ctx, "Build value").That(got).Equals(9)
+}
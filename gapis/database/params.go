@@ -0,0 +1,107 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+)
+
+// ParamsResolvable is the interface for resolvables whose value depends on
+// values held by the context of the resolve, as well as their content.
+// The database caches a separate value for each combination of the relevant
+// context values, and resolves each with a context holding those values.
+type ParamsResolvable interface {
+	Resolvable
+	// RelevantParams returns the keys of the context values that the resolved
+	// value depends on. The values must be storable in the database.
+	RelevantParams() []interface{}
+}
+
+// param is a context value used by the resolve of a partition.
+type param struct {
+	key, value interface{}
+}
+
+// bindParams returns ctx amended with the context values used to resolve the
+// record. Only partition records have context values.
+func (r *record) bindParams(ctx context.Context) context.Context {
+	for _, p := range r.params {
+		ctx = keys.WithValue(ctx, p.key, p.value)
+	}
+	return ctx
+}
+
+// partitionLocked returns the id of the record to resolve for i with the
+// context values of ctx, after following any aliases of i. For a
+// ParamsResolvable this is a partition record that is created for each
+// combination of the relevant values, otherwise it is the id of the aliased
+// record, or i.
+// partitionLocked must be called with a locked mutex.
+func (d *memory) partitionLocked(ctx context.Context, i id.ID) (id.ID, error) {
+	i, err := d.dealiasLocked(ctx, i)
+	if err != nil {
+		return i, err
+	}
+	r, got := d.records[i]
+	if !got || r.partition || r.resolveState != nil {
+		// Records that are resolved directly are not ParamsResolvables, and
+		// may have their object replaced by the resolve.
+		return i, nil
+	}
+	obj := r.object
+	if obj == nil {
+		obj = r.proto
+	}
+	pr, ok := obj.(ParamsResolvable)
+	if !ok {
+		return i, nil
+	}
+	keys := pr.RelevantParams()
+	params, inputs := make([]param, len(keys)), make([]id.ID, len(keys)+1)
+	inputs[0] = i
+	for j, k := range keys {
+		v := ctx.Value(k)
+		params[j] = param{k, v}
+		if v == nil {
+			continue // Absent values have the invalid id.
+		}
+		m, err := toProto(ctx, v)
+		if err != nil {
+			return i, log.Errf(ctx, err, "Relevant param %v of %v", k, i)
+		}
+		if inputs[j+1], err = hashProto(v, m); err != nil {
+			return i, err
+		}
+	}
+	pid := DerivedID(inputs, "params")
+	if _, got := d.records[pid]; !got {
+		p := &record{
+			proto:      r.proto,
+			object:     r.object,
+			created:    r.created,
+			stored:     r.stored,
+			resolvable: true,
+			params:     params,
+			partition:  true,
+		}
+		d.records[pid] = p
+		d.resizeLocked(p)
+	}
+	return pid, nil
+}
@@ -0,0 +1,141 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+type unitsKeyTy string
+
+const unitsKey = unitsKeyTy("units")
+
+var distanceResolves int32
+
+// distance resolves to its length formatted in the units held by the context.
+type distance struct {
+	Meters int32 `protobuf:"varint,1,opt,name=meters"`
+}
+
+func (m *distance) Reset()         { *m = distance{} }
+func (m *distance) String() string { return proto.CompactTextString(m) }
+func (*distance) ProtoMessage()    {}
+
+func (m *distance) RelevantParams() []interface{} { return []interface{}{unitsKey} }
+
+func (m *distance) Resolve(ctx context.Context) (interface{}, error) {
+	atomic.AddInt32(&distanceResolves, 1)
+	if ctx.Value(unitsKey) == "imperial" {
+		return fmt.Sprintf("%.0f ft", float64(m.Meters)*3.28084), nil
+	}
+	return fmt.Sprintf("%d m", m.Meters), nil
+}
+
+func TestParamsResolvable(t *testing.T) {
+	ctx := log.Testing(t)
+	atomic.StoreInt32(&distanceResolves, 0)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	metric := keys.WithValue(ctx, unitsKey, "metric")
+	imperial := keys.WithValue(ctx, unitsKey, "imperial")
+
+	i, err := database.Store(ctx, &distance{Meters: 100})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+
+	for _, test := range []struct {
+		name     string
+		ctx      context.Context
+		expected string
+	}{
+		{"metric", metric, "100 m"},
+		{"imperial", imperial, "328 ft"},
+		{"metric again", metric, "100 m"},
+		{"imperial again", imperial, "328 ft"},
+		{"no units", ctx, "100 m"},
+	} {
+		got, err := database.Resolve(test.ctx, i)
+		assert.For(ctx, "Resolve %v", test.name).ThatError(err).Succeeded()
+		assert.For(ctx, "Value %v", test.name).That(got).Equals(test.expected)
+	}
+	assert.For(ctx, "Resolves").That(atomic.LoadInt32(&distanceResolves)).Equals(int32(3))
+
+	b := database.Batch(imperial)
+	b.Add(i)
+	got, err := b.Resolve()
+	assert.For(ctx, "Batch").ThatError(err).Succeeded()
+	assert.For(ctx, "Batch value").That(got[0]).Equals("328 ft")
+	assert.For(ctx, "Batch resolves").That(atomic.LoadInt32(&distanceResolves)).Equals(int32(3))
+}
+
+func TestParamsResolvableCachedOnly(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	imperial := keys.WithValue(ctx, unitsKey, "imperial")
+
+	i, err := database.Store(ctx, &distance{Meters: 200})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	_, ok, err := database.ResolveCachedOnly(imperial, i)
+	assert.For(ctx, "Miss").ThatError(err).Succeeded()
+	assert.For(ctx, "Miss ok").That(ok).Equals(false)
+
+	_, err = database.Resolve(imperial, i)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	got, ok, err := database.ResolveCachedOnly(imperial, i)
+	assert.For(ctx, "Hit").ThatError(err).Succeeded()
+	assert.For(ctx, "Hit ok").That(ok).Equals(true)
+	assert.For(ctx, "Hit value").That(got).Equals("656 ft")
+
+	_, ok, err = database.ResolveCachedOnly(ctx, i)
+	assert.For(ctx, "Other params").ThatError(err).Succeeded()
+	assert.For(ctx, "Other params ok").That(ok).Equals(false)
+}
+
+func TestParamsResolvableStaleWhileRevalidate(t *testing.T) {
+	ctx := log.Testing(t)
+	atomic.StoreInt32(&distanceResolves, 0)
+	staleAfter := 100 * time.Millisecond
+	ctx = database.Put(ctx, database.NewInMemory(ctx, database.WithStaleWhileRevalidate(staleAfter)))
+	imperial := keys.WithValue(ctx, unitsKey, "imperial")
+
+	i, err := database.Store(ctx, &distance{Meters: 300})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	resolve := func() interface{} {
+		got, err := database.Resolve(imperial, i)
+		assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+		return got
+	}
+
+	assert.For(ctx, "First").That(resolve()).Equals("984 ft")
+	time.Sleep(2 * staleAfter)
+	assert.For(ctx, "Stale").That(resolve()).Equals("984 ft")
+
+	// Wait for the background refresh to finish.
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&distanceResolves) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	assert.For(ctx, "Refreshes").That(atomic.LoadInt32(&distanceResolves)).Equals(int32(2))
+	assert.For(ctx, "Refreshed").That(resolve()).Equals("984 ft")
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/fault"
+)
+
+// ErrNoDatabase is returned by WaitForDatabase when the context does not hold
+// a database, and has no pending database that one could be attached to.
+const ErrNoDatabase = fault.Const("Context has no database")
+
+// pendingDatabase is a database slot that is filled after the contexts holding
+// it have been created.
+type pendingDatabase struct {
+	once  sync.Once
+	ready chan struct{} // Closed once d is set
+	d     Database
+}
+
+// get returns the attached database, or nil if no database has been attached.
+func (p *pendingDatabase) get() Database {
+	select {
+	case <-p.ready:
+		return p.d
+	default:
+		return nil
+	}
+}
+
+// PutPending amends a Context by attaching a slot for a Database that is not
+// yet available. The Database is attached by calling the returned function,
+// after which Get returns it for every context derived from the returned
+// context. Only the first call to the returned function has any effect.
+func PutPending(ctx context.Context) (context.Context, func(Database)) {
+	if val := ctx.Value(databaseKey); val != nil {
+		panic("Context already holds database")
+	}
+	p := &pendingDatabase{ready: make(chan struct{})}
+	attach := func(d Database) {
+		p.once.Do(func() {
+			p.d = d
+			close(p.ready)
+		})
+	}
+	return keys.WithValue(ctx, databaseKey, p), attach
+}
+
+// WaitForDatabase returns the Database attached to the given context, blocking
+// until a database is attached to the context's pending slot or the context is
+// cancelled. As contexts are immutable, WaitForDatabase returns ErrNoDatabase
+// without blocking if the context holds neither a database nor a pending slot
+// made with PutPending.
+func WaitForDatabase(ctx context.Context) (Database, error) {
+	switch val := ctx.Value(databaseKey).(type) {
+	case Database:
+		return val, nil
+	case *pendingDatabase:
+		select {
+		case <-val.ready:
+			return val.d, nil
+		case <-task.ShouldStop(ctx):
+			return nil, task.StopReason(ctx)
+		}
+	}
+	return nil, ErrNoDatabase
+}
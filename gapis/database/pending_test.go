@@ -0,0 +1,52 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestWaitForDatabase(t *testing.T) {
+	ctx := log.Testing(t)
+
+	_, err := database.WaitForDatabase(ctx)
+	assert.For(ctx, "No database").ThatError(err).Equals(database.ErrNoDatabase)
+
+	pending, attach := database.PutPending(ctx)
+	timeout, cancel := context.WithTimeout(pending, 10*time.Millisecond)
+	_, err = database.WaitForDatabase(timeout)
+	cancel()
+	assert.For(ctx, "Deadline").ThatError(err).Equals(context.DeadlineExceeded)
+
+	d := database.NewInMemory(ctx)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		attach(d)
+	}()
+	got, err := database.WaitForDatabase(pending)
+	assert.For(ctx, "Wait").ThatError(err).Succeeded()
+	assert.For(ctx, "Waited database").That(got).Equals(d)
+	assert.For(ctx, "Get").That(database.Get(pending)).Equals(d)
+
+	got, err = database.WaitForDatabase(database.Put(ctx, d))
+	assert.For(ctx, "Attached").ThatError(err).Succeeded()
+	assert.For(ctx, "Attached database").That(got).Equals(d)
+}
@@ -0,0 +1,167 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/event/task"
+)
+
+// WithResolvePool returns an Option that limits the number of go-routines
+// building resolvables to size, however the resolvables fan out.
+// Resolves started by a resolvable that cannot get a free slot are built on
+// the go-routine that waits for them, so nested resolves never block waiting
+// for a slot held by their parent. Other resolves wait for a free slot, which
+// is given to the waiting resolve with the highest priority. See
+// ResolveWithPriority.
+func WithResolvePool(size int) Option {
+	return func(m *memory) { m.pool = &resolvePool{size: size} }
+}
+
+// priorityAging is the time a queued resolve waits to be raised by one
+// priority level, so lower priority resolves are never starved.
+const priorityAging = 100 * time.Millisecond
+
+// resolvePool holds the slots for building resolvables, and the resolves
+// waiting for a slot.
+type resolvePool struct {
+	size  int            // Number of slots
+	busy  int            // Number of slots in use
+	queue []*queuedBuild // Resolves waiting for a slot
+}
+
+// queuedBuild is a resolve waiting for a slot of the pool.
+type queuedBuild struct {
+	priority   Priority
+	queued     time.Time
+	dispatched chan struct{} // Closed when the build is given a slot
+	build      func()
+}
+
+// effective returns the priority of q, raised by the time it has waited at
+// now.
+func (q *queuedBuild) effective(now time.Time) Priority {
+	return q.priority + Priority(now.Sub(q.queued)/priorityAging)
+}
+
+// scheduleLocked arranges for build to be called to build the resolve rs of
+// the record r, where rc is the resolve chain of the resolve and pri is the
+// priority of the caller that started it.
+// scheduleLocked must be called with a locked mutex.
+func (d *memory) scheduleLocked(id id.ID, r *record, rs *resolveState, rc *resolveChain, pri Priority, build func(context.Context)) {
+	p := d.pool
+	if p.busy < p.size {
+		p.busy++
+		go d.runPooled(func() { build(rs.ctx) })
+		return
+	}
+	if rc.parent != nil {
+		// Nested resolve, and the pool is full. Build it on the go-routine of
+		// the first caller to wait for it.
+		rs.pending = func() { build(rs.ctx) }
+		return
+	}
+	q := &queuedBuild{
+		priority:   pri,
+		queued:     time.Now(),
+		dispatched: make(chan struct{}),
+		build:      func() { build(rs.ctx) },
+	}
+	p.queue = append(p.queue, q)
+	go func() {
+		select {
+		case <-q.dispatched:
+		case <-task.ShouldStop(rs.ctx):
+			d.mutex.Lock()
+			removed := p.removeLocked(q)
+			d.mutex.Unlock()
+			if removed {
+				d.finishResolve(id, r, rs, DefaultCache, task.StopReason(rs.ctx))
+			}
+		}
+	}()
+}
+
+// scheduleBackgroundLocked runs build in a slot of the pool, queueing it at
+// Low priority if the pool is full. Unlike scheduleLocked, build is not tied
+// to a waiting caller, so it is never cancelled or built on a caller's
+// go-routine.
+// scheduleBackgroundLocked must be called with a locked mutex.
+func (d *memory) scheduleBackgroundLocked(build func()) {
+	p := d.pool
+	if p.busy < p.size {
+		p.busy++
+		go d.runPooled(build)
+		return
+	}
+	p.queue = append(p.queue, &queuedBuild{
+		priority:   Low,
+		queued:     time.Now(),
+		dispatched: make(chan struct{}),
+		build:      build,
+	})
+}
+
+// runPooled calls build, and then gives the slot it held to the next queued
+// resolve.
+func (d *memory) runPooled(build func()) {
+	defer func() {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		p := d.pool
+		p.busy--
+		if q := p.nextLocked(); q != nil {
+			p.busy++
+			close(q.dispatched)
+			go d.runPooled(q.build)
+		}
+	}()
+	build()
+}
+
+// nextLocked removes and returns the queued resolve with the highest effective
+// priority, picking the longest waiting of equal priorities. nextLocked
+// returns nil if the queue is empty.
+// nextLocked must be called with a locked mutex.
+func (p *resolvePool) nextLocked() *queuedBuild {
+	if len(p.queue) == 0 {
+		return nil
+	}
+	now, best := time.Now(), 0
+	for i, q := range p.queue[1:] {
+		if q.effective(now) > p.queue[best].effective(now) {
+			best = i + 1
+		}
+	}
+	q := p.queue[best]
+	p.queue = append(p.queue[:best], p.queue[best+1:]...)
+	return q
+}
+
+// removeLocked removes q from the queue, returning false if q is no longer
+// queued.
+// removeLocked must be called with a locked mutex.
+func (p *resolvePool) removeLocked(q *queuedBuild) bool {
+	for i, o := range p.queue {
+		if o == q {
+			p.queue = append(p.queue[:i], p.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
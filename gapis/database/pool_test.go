@@ -0,0 +1,173 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestResolvePool(t *testing.T) {
+	ctx := log.Testing(t)
+	const size, fanOut, depth = 4, 4, 4
+	ctx = database.Put(ctx, database.NewInMemory(ctx, database.WithResolvePool(size)))
+
+	baseline := runtime.NumGoroutine()
+	mutex, maxGoroutines, leaves := sync.Mutex{}, 0, 0
+
+	var node func(level, index int) *testResolvable
+	node = func(level, index int) *testResolvable {
+		name := fmt.Sprintf("pool-%d-%d", level, index)
+		return newResolvable(name, func(ctx context.Context) (interface{}, error) {
+			if level == depth {
+				time.Sleep(time.Millisecond)
+				mutex.Lock()
+				defer mutex.Unlock()
+				if n := runtime.NumGoroutine(); n > maxGoroutines {
+					maxGoroutines = n
+				}
+				leaves++
+				return 1, nil
+			}
+			b := database.Batch(ctx)
+			for i := 0; i < fanOut; i++ {
+				id, err := database.Store(ctx, node(level+1, index*fanOut+i))
+				if err != nil {
+					return nil, err
+				}
+				b.Add(id)
+			}
+			children, err := b.Resolve()
+			if err != nil {
+				return nil, err
+			}
+			sum := 0
+			for _, c := range children {
+				sum += c.(int)
+			}
+			return sum, nil
+		})
+	}
+
+	got, err := database.Build(ctx, node(0, 0))
+	assert.For(ctx, "Build").ThatError(err).Succeeded()
+	assert.For(ctx, "Sum").That(got).Equals(256)
+	assert.For(ctx, "Leaves").That(leaves).Equals(256)
+	assert.For(ctx, "Goroutines").That(maxGoroutines-baseline <= size+2).Equals(true)
+}
+
+func TestResolveWithPriority(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx, database.WithResolvePool(1)))
+
+	mutex, order := sync.Mutex{}, []database.Priority{}
+	release := make(chan struct{})
+	blocker, err := database.Store(ctx, newResolvable("priority-blocker", func(context.Context) (interface{}, error) {
+		<-release
+		return 0, nil
+	}))
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+
+	wg := sync.WaitGroup{}
+	resolve := func(i id.ID, pri database.Priority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := database.ResolveWithPriority(ctx, i, pri)
+			assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+		}()
+	}
+	waitInFlight := func(n int) {
+		for len(database.InFlight(ctx)) < n {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	resolve(blocker, database.Normal)
+	waitInFlight(1)
+	queued := 1
+	for _, pri := range []database.Priority{database.Low, database.Low, database.High, database.Low, database.High} {
+		pri := pri
+		i, err := database.Store(ctx, newResolvable(fmt.Sprintf("priority-%d", queued), func(context.Context) (interface{}, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			order = append(order, pri)
+			return 0, nil
+		}))
+		assert.For(ctx, "Store").ThatError(err).Succeeded()
+		resolve(i, pri)
+		queued++
+		waitInFlight(queued)
+	}
+	close(release)
+	wg.Wait()
+
+	assert.For(ctx, "Order").ThatSlice(order).Equals([]database.Priority{
+		database.High, database.High, database.Low, database.Low, database.Low,
+	})
+}
+
+func TestResolvePriorityAging(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx, database.WithResolvePool(1)))
+
+	mutex, order := sync.Mutex{}, []string{}
+	release := make(chan struct{})
+	record := func(name string) id.ID {
+		i, err := database.Store(ctx, newResolvable("aging-"+name, func(context.Context) (interface{}, error) {
+			if name == "blocker" {
+				<-release
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			order = append(order, name)
+			return 0, nil
+		}))
+		assert.For(ctx, "Store").ThatError(err).Succeeded()
+		return i
+	}
+	wg := sync.WaitGroup{}
+	resolve := func(name string, pri database.Priority) {
+		i, n := record(name), len(database.InFlight(ctx))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := database.ResolveWithPriority(ctx, i, pri)
+			assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+		}()
+		for len(database.InFlight(ctx)) == n {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	resolve("blocker", database.Normal)
+	resolve("low", database.Low)
+	// Wait long enough for the low priority resolve to be raised above High.
+	time.Sleep(300 * time.Millisecond)
+	resolve("high", database.High)
+	close(release)
+	wg.Wait()
+
+	assert.For(ctx, "Order").ThatSlice(order).Equals([]string{"blocker", "low", "high"})
+}
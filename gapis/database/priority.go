@@ -0,0 +1,60 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/data/id"
+)
+
+// Priority is the priority of a resolve waiting for a slot of the resolve
+// pool. See WithResolvePool.
+type Priority int
+
+const (
+	// Low is the priority of background work, such as prefetches.
+	Low = Priority(-1)
+	// Normal is the priority of resolves made with Resolve.
+	Normal = Priority(0)
+	// High is the priority of resolves that a user is waiting for.
+	High = Priority(1)
+)
+
+type priorityKeyTy string
+
+const priorityKey = priorityKeyTy("resolvePriority")
+
+// ResolveWithPriority resolves id with the database held by the context like
+// Resolve. If the resolve has to wait for a slot of the database's resolve
+// pool, it is given a slot before the waiting resolves of lower priority.
+// Resolves that have waited long enough are raised in priority, so lower
+// priority resolves are delayed but never starved.
+// The priority of a resolve is the priority of the caller that started it.
+func ResolveWithPriority(ctx context.Context, id id.ID, pri Priority) (interface{}, error) {
+	if fn := overrideFor(ctx, id); fn != nil {
+		return fn(ctx)
+	}
+	return Get(ctx).resolve(keys.WithValue(ctx, priorityKey, pri), id)
+}
+
+// priorityOf returns the priority of the resolves made with ctx.
+func priorityOf(ctx context.Context) Priority {
+	if pri, ok := ctx.Value(priorityKey).(Priority); ok {
+		return pri
+	}
+	return Normal
+}
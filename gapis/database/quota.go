@@ -0,0 +1,99 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+)
+
+// ErrQuotaExceeded is returned when a store would take a caller over their
+// quota.
+const ErrQuotaExceeded = fault.Const("Database quota exceeded")
+
+// WithQuota returns a Database that forwards all operations to d, limiting
+// the total size of the protos stored by each caller to quotaBytes.
+// caller returns the name of the caller that owns the context. Stores of ids
+// that are already held by the database are not charged to the caller, and
+// each id is charged once, to the first caller to store it.
+// Only stores made through the returned Database are charged. Resolvables are
+// built by d with d's own context, so values they store, such as the chunks
+// of a ReaderResolvable, are not charged to any caller.
+func WithQuota(d Database, quotaBytes uint64, caller func(ctx context.Context) string) Database {
+	return &quota{
+		inner:   d,
+		quota:   quotaBytes,
+		caller:  caller,
+		used:    map[string]uint64{},
+		charged: map[id.ID]bool{},
+	}
+}
+
+type quota struct {
+	inner   Database
+	quota   uint64
+	caller  func(ctx context.Context) string
+	mutex   sync.Mutex
+	used    map[string]uint64 // Bytes stored by each caller
+	charged map[id.ID]bool    // Ids that have been charged to a caller
+}
+
+// Implements Database
+func (d *quota) store(ctx context.Context, id id.ID, v interface{}, m proto.Message) error {
+	caller, size := d.caller(ctx), uint64(proto.Size(m))
+	d.mutex.Lock()
+	if d.charged[id] || d.inner.contains(ctx, id) {
+		d.mutex.Unlock()
+		return d.inner.store(ctx, id, v, m)
+	}
+	used := d.used[caller]
+	if used+size > d.quota {
+		d.mutex.Unlock()
+		return log.Errf(ctx, ErrQuotaExceeded, "Caller '%v' storing %v bytes with %v of %v used",
+			caller, size, used, d.quota)
+	}
+	d.used[caller] = used + size
+	d.charged[id] = true
+	d.mutex.Unlock()
+
+	if err := d.inner.store(ctx, id, v, m); err != nil {
+		d.mutex.Lock()
+		d.used[caller] -= size
+		delete(d.charged, id)
+		d.mutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Implements Database
+func (d *quota) resolve(ctx context.Context, id id.ID) (interface{}, error) {
+	return d.inner.resolve(ctx, id)
+}
+
+// Implements normalizer
+func (d *quota) normalize(m proto.Message) proto.Message {
+	return normalizeWith(d.inner, m)
+}
+
+// Implements Database
+func (d *quota) contains(ctx context.Context, id id.ID) bool {
+	return d.inner.contains(ctx, id)
+}
@@ -0,0 +1,91 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+type tenantKeyTy string
+
+const tenantKey = tenantKeyTy("tenant")
+
+func tenant(ctx context.Context) string {
+	name, _ := ctx.Value(tenantKey).(string)
+	return name
+}
+
+func TestQuota(t *testing.T) {
+	ctx := log.Testing(t)
+	d := database.WithQuota(database.NewInMemory(ctx), 100, tenant)
+	ctx = database.Put(ctx, d)
+	greedy := keys.WithValue(ctx, tenantKey, "greedy")
+	modest := keys.WithValue(ctx, tenantKey, "modest")
+
+	// Each person is 11 bytes, so the greedy tenant fits 9.
+	var err error
+	stored := 0
+	for ; stored < 20; stored++ {
+		if _, err = database.Store(greedy, &personV2{First: fmt.Sprintf("Greedy %02d", stored)}); err != nil {
+			break
+		}
+	}
+	assert.For(ctx, "Greedy error").ThatError(err).HasCause(database.ErrQuotaExceeded)
+	assert.For(ctx, "Greedy stored").That(stored).Equals(9)
+
+	// The greedy tenant can still store values that are already held.
+	_, err = database.Store(greedy, &personV2{First: "Greedy 00"})
+	assert.For(ctx, "Greedy duplicate").ThatError(err).Succeeded()
+
+	for i := 0; i < 8; i++ {
+		i, err := database.Store(modest, &personV2{First: fmt.Sprintf("Modest %02d", i)})
+		assert.For(ctx, "Modest store").ThatError(err).Succeeded()
+		_, err = database.Resolve(greedy, i)
+		assert.For(ctx, "Greedy resolve").ThatError(err).Succeeded()
+	}
+}
+
+func TestQuotaConcurrentStores(t *testing.T) {
+	ctx := log.Testing(t)
+	d := database.WithQuota(database.NewInMemory(ctx), 25, tenant)
+	ctx = keys.WithValue(database.Put(ctx, d), tenantKey, "racer")
+
+	// Concurrent first stores of the same value are charged once.
+	errs := make([]error, 10)
+	wg := sync.WaitGroup{}
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = database.Store(ctx, &personV2{First: "Racer 00"})
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		assert.For(ctx, "Store %d", i).ThatError(err).Succeeded()
+	}
+	_, err := database.Store(ctx, &personV2{First: "Racer 01"})
+	assert.For(ctx, "Second value").ThatError(err).Succeeded()
+	_, err = database.Store(ctx, &personV2{First: "Racer 02"})
+	assert.For(ctx, "Third value").ThatError(err).HasCause(database.ErrQuotaExceeded)
+}
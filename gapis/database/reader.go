@@ -0,0 +1,112 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/google/gapid/core/data/id"
+)
+
+// ReaderResolvable is the interface for types that lazily build a blob that
+// is too large to hold in memory at once. The first time the object is
+// resolved, the database drains the reader into content-defined chunks, as
+// stored by StoreChunked, and the object resolves to the ChunkedBlob manifest
+// of the chunks. The blob can then be streamed back with ResolveReader.
+type ReaderResolvable interface {
+	// ResolveReader returns a reader of the blob and the length of the blob
+	// in bytes.
+	ResolveReader(ctx context.Context) (io.Reader, uint64, error)
+}
+
+// storeReader reads size bytes from r, storing them to the database held by
+// the context with chunks split as StoreChunked would split them. At most
+// two chunks of r are held in memory at any time.
+func storeReader(ctx context.Context, r io.Reader, size uint64) (*ChunkedBlob, error) {
+	blob := &ChunkedBlob{Size: size}
+	buf, read, eof := make([]byte, 0, 2*maxChunkSize), uint64(0), false
+	for !eof || len(buf) > 0 {
+		if !eof && len(buf) < maxChunkSize {
+			n, err := io.ReadFull(r, buf[len(buf):cap(buf)])
+			buf, read = buf[:len(buf)+n], read+uint64(n)
+			switch err {
+			case nil:
+			case io.EOF, io.ErrUnexpectedEOF:
+				eof = true
+			default:
+				return nil, err
+			}
+			continue
+		}
+		n := nextChunk(buf)
+		i, err := Store(ctx, &Chunk{Data: append([]byte{}, buf[:n]...)})
+		if err != nil {
+			return nil, err
+		}
+		blob.Chunks = append(blob.Chunks, i[:])
+		buf = buf[:copy(buf, buf[n:])]
+	}
+	if read != size {
+		return nil, fmt.Errorf("Reader returned %d bytes, expected %d", read, size)
+	}
+	return blob, nil
+}
+
+// ResolveReader resolves the blob with the given id using the database held
+// by the context, returning a reader of the blob and the length of the blob in
+// bytes. id can be the id of a ReaderResolvable or of a manifest stored with
+// StoreChunked. The chunks of the blob are resolved as they are read.
+func ResolveReader(ctx context.Context, id id.ID) (io.Reader, uint64, error) {
+	v, err := Resolve(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	blob, ok := v.(*ChunkedBlob)
+	if !ok {
+		return nil, 0, fmt.Errorf("Resource '%v' is not a chunked blob. Got %T", id, v)
+	}
+	return &chunkReader{ctx: ctx, id: id, chunks: blob.Chunks}, blob.Size, nil
+}
+
+// chunkReader is an io.Reader over the chunks of a ChunkedBlob.
+type chunkReader struct {
+	ctx    context.Context
+	id     id.ID    // The id of the blob
+	chunks [][]byte // The ids of the chunks not yet resolved
+	data   []byte   // The unread data of the current chunk
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		if len(r.chunks) == 0 {
+			return 0, io.EOF
+		}
+		c := chunkID(r.chunks[0])
+		v, err := Resolve(r.ctx, c)
+		if err != nil {
+			return 0, err
+		}
+		chunk, ok := v.(*Chunk)
+		if !ok {
+			return 0, fmt.Errorf("Chunk '%v' of '%v' is not a chunk. Got %T", c, r.id, v)
+		}
+		r.chunks, r.data = r.chunks[1:], chunk.Data
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
@@ -0,0 +1,117 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+// streamPeakRead is the largest read made from the stream of a
+// streamResolvable.
+var streamPeakRead int64
+
+// streamResolvable streams Size random bytes, generated from Seed.
+type streamResolvable struct {
+	Size uint64 `protobuf:"varint,1,opt,name=size"`
+	Seed int64  `protobuf:"varint,2,opt,name=seed"`
+}
+
+func (m *streamResolvable) Reset()         { *m = streamResolvable{} }
+func (m *streamResolvable) String() string { return proto.CompactTextString(m) }
+func (*streamResolvable) ProtoMessage()    {}
+
+// peakReader records the largest read made from r in streamPeakRead.
+type peakReader struct{ r io.Reader }
+
+func (p peakReader) Read(b []byte) (int, error) {
+	for n := int64(len(b)); ; {
+		peak := atomic.LoadInt64(&streamPeakRead)
+		if n <= peak || atomic.CompareAndSwapInt64(&streamPeakRead, peak, n) {
+			break
+		}
+	}
+	return p.r.Read(b)
+}
+
+func (m *streamResolvable) ResolveReader(ctx context.Context) (io.Reader, uint64, error) {
+	r := rand.New(rand.NewSource(m.Seed))
+	return peakReader{io.LimitReader(r, int64(m.Size))}, m.Size, nil
+}
+
+func TestReaderResolvable(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	expected := make([]byte, 1<<20)
+	rand.New(rand.NewSource(3)).Read(expected)
+	chunkedID, err := database.StoreChunked(ctx, expected)
+	assert.For(ctx, "StoreChunked").ThatError(err).Succeeded()
+
+	i, err := database.Store(ctx, &streamResolvable{Size: 1 << 20, Seed: 3})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	manifest, err := database.Resolve(ctx, i)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	manifestID, err := database.Hash(ctx, manifest)
+	assert.For(ctx, "Hash").ThatError(err).Succeeded()
+	assert.For(ctx, "Manifest id").That(manifestID).Equals(chunkedID)
+
+	r, size, err := database.ResolveReader(ctx, i)
+	assert.For(ctx, "ResolveReader").ThatError(err).Succeeded()
+	assert.For(ctx, "Size").That(size).Equals(uint64(1 << 20))
+	got, err := ioutil.ReadAll(r)
+	assert.For(ctx, "ReadAll").ThatError(err).Succeeded()
+	assert.For(ctx, "Data").That(bytes.Equal(got, expected)).Equals(true)
+}
+
+func TestReaderResolvableBoundedMemory(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	// Use random data so that the chunks don't dedupe, and check that the
+	// stream is never read into a buffer much larger than a chunk.
+	const size, seed = 16 << 20, 7
+	atomic.StoreInt64(&streamPeakRead, 0)
+	i, err := database.Store(ctx, &streamResolvable{Size: size, Seed: seed})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	r, got, err := database.ResolveReader(ctx, i)
+	assert.For(ctx, "ResolveReader").ThatError(err).Succeeded()
+	assert.For(ctx, "Size").That(got).Equals(uint64(size))
+	assert.For(ctx, "Peak read").That(atomic.LoadInt64(&streamPeakRead) <= 1<<20).Equals(true)
+
+	expected := rand.New(rand.NewSource(seed))
+	read, buf, want := 0, make([]byte, 32<<10), make([]byte, 32<<10)
+	for {
+		n, err := r.Read(buf)
+		io.ReadFull(expected, want[:n])
+		assert.For(ctx, "Data at %d", read).That(bytes.Equal(buf[:n], want[:n])).Equals(true)
+		read += n
+		if err == io.EOF {
+			break
+		}
+		assert.For(ctx, "Read").ThatError(err).Succeeded()
+	}
+	assert.For(ctx, "Read").That(read).Equals(size)
+}
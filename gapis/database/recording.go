@@ -0,0 +1,220 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/data/protoconv"
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+)
+
+// NewRecordingDatabase returns a Database that forwards all operations to
+// inner, writing each operation to w as a stream of length-prefixed Operation
+// messages. Resolved values are included in the stream so that the recording
+// can be served with ReplayDatabase.
+// Only the operations made through the returned Database are recorded.
+// Resolvables built by inner are handed a context holding inner, not the
+// recorder, so the stores and resolves they make are not recorded. Replaying
+// such a recording serves the values built by the resolvables, but not the
+// intermediate values they used.
+func NewRecordingDatabase(inner Database, w io.Writer) Database {
+	return &recorder{inner: inner, w: w}
+}
+
+type recorder struct {
+	inner Database
+	mutex sync.Mutex
+	w     io.Writer
+	buf   proto.Buffer
+}
+
+func (d *recorder) write(ctx context.Context, op *Operation, start time.Time, err error) {
+	op.Timestamp = start.UnixNano()
+	op.Duration = int64(time.Since(start))
+	if err != nil {
+		op.Error = err.Error()
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.buf.Reset()
+	if err := d.buf.EncodeMessage(op); err != nil {
+		log.E(ctx, "Failed to encode recorded %v operation: %v", op.Op, err)
+		return
+	}
+	if _, err := d.w.Write(d.buf.Bytes()); err != nil {
+		log.E(ctx, "Failed to write recorded %v operation: %v", op.Op, err)
+	}
+}
+
+// Implements Database
+func (d *recorder) store(ctx context.Context, id id.ID, v interface{}, m proto.Message) error {
+	start := time.Now()
+	err := d.inner.store(ctx, id, v, m)
+	d.write(ctx, &Operation{Op: Op_Store, Id: id[:], Size: uint64(proto.Size(m))}, start, err)
+	return err
+}
+
+// Implements Database
+func (d *recorder) resolve(ctx context.Context, id id.ID) (interface{}, error) {
+	start := time.Now()
+	out, err := d.inner.resolve(ctx, id)
+	op := &Operation{Op: Op_Resolve, Id: id[:]}
+	if err == nil {
+		if m, err := toProto(ctx, out); err == nil {
+			if data, err := proto.Marshal(m); err == nil {
+				op.Size, op.ValueType, op.Value = uint64(len(data)), proto.MessageName(m), data
+			}
+		}
+	}
+	d.write(ctx, op, start, err)
+	return out, err
+}
+
+// Implements Database
+func (d *recorder) contains(ctx context.Context, id id.ID) bool {
+	start := time.Now()
+	found := d.inner.contains(ctx, id)
+	d.write(ctx, &Operation{Op: Op_Contains, Id: id[:], Found: found}, start, nil)
+	return found
+}
+
+// Implements normalizer
+func (d *recorder) normalize(m proto.Message) proto.Message {
+	return normalizeWith(d.inner, m)
+}
+
+// ErrNotRecorded is returned by a replay database when resolving an id that
+// has no recorded value.
+const ErrNotRecorded = fault.Const("Operation was not recorded")
+
+// ReplayDatabase returns a Database that serves the operations recorded by
+// a database built with NewRecordingDatabase.
+// Resolves return the first value or error recorded for the id, contains
+// returns the first recorded result, and stores return the first recorded
+// store error for the id. Unrecorded resolves return ErrNotRecorded.
+func ReplayDatabase(r io.Reader) (Database, error) {
+	d := &replay{
+		stored:   map[id.ID]error{},
+		resolved: map[id.ID]*Operation{},
+		found:    map[id.ID]bool{},
+	}
+	br := bufio.NewReader(r)
+	for {
+		size, err := binary.ReadUvarint(br)
+		switch {
+		case err == io.EOF:
+			return d, nil
+		case err != nil:
+			return nil, err
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, err
+		}
+		op := &Operation{}
+		if err := proto.Unmarshal(data, op); err != nil {
+			return nil, err
+		}
+		i := id.ID{}
+		copy(i[:], op.Id)
+		switch op.Op {
+		case Op_Store:
+			if _, ok := d.stored[i]; !ok {
+				d.stored[i] = replayError(op)
+			}
+		case Op_Resolve:
+			if _, ok := d.resolved[i]; !ok {
+				d.resolved[i] = op
+			}
+		case Op_Contains:
+			if _, ok := d.found[i]; !ok {
+				d.found[i] = op.Found
+			}
+		}
+	}
+}
+
+func replayError(op *Operation) error {
+	if op.Error == "" {
+		return nil
+	}
+	return fault.Const(op.Error)
+}
+
+type replay struct {
+	stored   map[id.ID]error      // First recorded store error for each id
+	resolved map[id.ID]*Operation // First recorded resolve for each id
+	found    map[id.ID]bool       // First recorded contains result for each id
+}
+
+// Implements Database
+func (d *replay) store(ctx context.Context, id id.ID, v interface{}, m proto.Message) error {
+	return d.stored[id]
+}
+
+// Implements Database
+func (d *replay) resolve(ctx context.Context, id id.ID) (interface{}, error) {
+	op, ok := d.resolved[id]
+	if !ok {
+		return nil, log.Errf(ctx, ErrNotRecorded, "Resolve of '%v'", id)
+	}
+	if err := replayError(op); err != nil {
+		return nil, err
+	}
+	if op.ValueType == "" {
+		return nil, log.Errf(ctx, ErrNotRecorded, "Value of '%v'", id)
+	}
+	ty := proto.MessageType(op.ValueType)
+	if ty == nil {
+		return nil, fmt.Errorf("Unknown recorded proto type '%v'", op.ValueType)
+	}
+	m := reflect.New(ty.Elem()).Interface().(proto.Message)
+	if err := proto.Unmarshal(op.Value, m); err != nil {
+		return nil, err
+	}
+	m, err := migrate(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := fromProto(ctx, m)
+	switch err.(type) {
+	case nil:
+		return obj, nil
+	case protoconv.ErrNoConverterRegistered:
+		return m, nil
+	default:
+		return nil, err
+	}
+}
+
+// Implements Database
+func (d *replay) contains(ctx context.Context, id id.ID) bool {
+	if found, ok := d.found[id]; ok {
+		return found
+	}
+	_, ok := d.resolved[id]
+	return ok
+}
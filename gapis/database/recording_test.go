@@ -0,0 +1,88 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	proto.RegisterType((*personV2)(nil), "database_test.personV2")
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := log.Testing(t)
+	buf := &bytes.Buffer{}
+	recCtx := database.Put(ctx, database.NewRecordingDatabase(database.NewInMemory(ctx), buf))
+
+	built, err := database.Store(recCtx, newResolvable("record-and-replay", func(context.Context) (interface{}, error) {
+		return &personV2{First: "Ada", Last: "Lovelace"}, nil
+	}))
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	_, err = database.Resolve(recCtx, built)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	missing := id.OfString("missing")
+	_, err = database.Resolve(recCtx, missing)
+	assert.For(ctx, "Resolve missing").ThatError(err).Failed()
+
+	replay, err := database.ReplayDatabase(buf)
+	assert.For(ctx, "ReplayDatabase").ThatError(err).Succeeded()
+	replayCtx := database.Put(ctx, replay)
+
+	got, err := database.Resolve(replayCtx, built)
+	assert.For(ctx, "Replayed resolve").ThatError(err).Succeeded()
+	assert.For(ctx, "Replayed value").That(got).DeepEquals(&personV2{First: "Ada", Last: "Lovelace"})
+	_, err = database.Resolve(replayCtx, missing)
+	assert.For(ctx, "Replayed missing").ThatError(err).Failed()
+	_, err = database.Resolve(replayCtx, id.OfString("unrecorded"))
+	assert.For(ctx, "Unrecorded").That(errors.Cause(err)).Equals(database.ErrNotRecorded)
+}
+
+func TestRecordSkipsNestedOperations(t *testing.T) {
+	ctx := log.Testing(t)
+	buf := &bytes.Buffer{}
+	recCtx := database.Put(ctx, database.NewRecordingDatabase(database.NewInMemory(ctx), buf))
+
+	var nested id.ID
+	built, err := database.Store(recCtx, newResolvable("record-nested", func(ctx context.Context) (interface{}, error) {
+		var err error
+		nested, err = database.Store(ctx, &personV2{First: "Charles", Last: "Babbage"})
+		if err != nil {
+			return nil, err
+		}
+		return database.Resolve(ctx, nested)
+	}))
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	_, err = database.Resolve(recCtx, built)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+
+	replay, err := database.ReplayDatabase(buf)
+	assert.For(ctx, "ReplayDatabase").ThatError(err).Succeeded()
+	replayCtx := database.Put(ctx, replay)
+	got, err := database.Resolve(replayCtx, built)
+	assert.For(ctx, "Replayed resolve").ThatError(err).Succeeded()
+	assert.For(ctx, "Replayed value").That(got).DeepEquals(&personV2{First: "Charles", Last: "Babbage"})
+	_, err = database.Resolve(replayCtx, nested)
+	assert.For(ctx, "Nested").That(errors.Cause(err)).Equals(database.ErrNotRecorded)
+}
@@ -0,0 +1,52 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+	"github.com/pkg/errors"
+)
+
+// ErrTransientDevice is returned (or wrapped) by resolvables that failed
+// because a device they read from briefly disconnected. See
+// WithDeviceRecovery.
+const ErrTransientDevice = fault.Const("Transient device failure")
+
+// WithDeviceRecovery returns an Option that handles resolvables failing with
+// ErrTransientDevice by calling reconnect and then retrying the resolve once.
+// The retry continues from the resolvable that failed, so the resolvables it
+// was built from are not resolved again. If reconnect fails, the resolve fails
+// with the original error.
+func WithDeviceRecovery(reconnect func(ctx context.Context) error) Option {
+	return func(m *memory) { m.reconnect = reconnect }
+}
+
+// resolveWithRecovery resolves r, retrying once after a reconnect if the
+// resolve fails with ErrTransientDevice.
+func (d *memory) resolveWithRecovery(ctx context.Context, r *record) (CachePolicy, error) {
+	policy, err := r.resolve(ctx)
+	if d.reconnect == nil || errors.Cause(err) != ErrTransientDevice {
+		return policy, err
+	}
+	log.W(ctx, "Reconnecting after resolve of %v failed: %v", r.typename(), err)
+	if rerr := d.reconnect(ctx); rerr != nil {
+		log.E(ctx, "Failed to reconnect: %v", rerr)
+		return policy, err
+	}
+	return r.resolve(ctx)
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+	"github.com/pkg/errors"
+)
+
+func TestDeviceRecovery(t *testing.T) {
+	ctx := log.Testing(t)
+	connected, reconnects := true, 0
+	ctx = database.Put(ctx, database.NewInMemory(ctx, database.WithDeviceRecovery(func(context.Context) error {
+		reconnects++
+		connected = true
+		return nil
+	})))
+
+	attempts := 0
+	got, err := database.Build(ctx, newResolvable("device-recovery", func(ctx context.Context) (interface{}, error) {
+		attempts++
+		if attempts == 1 {
+			connected = false // The device disconnects during the first attempt.
+		}
+		if !connected {
+			return nil, log.Err(ctx, database.ErrTransientDevice, "Reading from device")
+		}
+		return "frame", nil
+	}))
+	assert.For(ctx, "Build").ThatError(err).Succeeded()
+	assert.For(ctx, "Value").That(got).Equals("frame")
+	assert.For(ctx, "Attempts").That(attempts).Equals(2)
+	assert.For(ctx, "Reconnects").That(reconnects).Equals(1)
+}
+
+func TestDeviceRecoveryRetriesOnce(t *testing.T) {
+	ctx := log.Testing(t)
+	const errUnplugged = fault.Const("Unplugged")
+	ctx = database.Put(ctx, database.NewInMemory(ctx, database.WithDeviceRecovery(func(context.Context) error {
+		return nil
+	})))
+
+	attempts := 0
+	_, err := database.Build(ctx, newResolvable("device-recovery-once", func(ctx context.Context) (interface{}, error) {
+		attempts++
+		return nil, database.ErrTransientDevice
+	}))
+	assert.For(ctx, "Build").That(errors.Cause(err)).Equals(database.ErrTransientDevice)
+	assert.For(ctx, "Attempts").That(attempts).Equals(2)
+
+	_, err = database.Build(ctx, newResolvable("device-recovery-other", func(ctx context.Context) (interface{}, error) {
+		attempts++
+		return nil, errUnplugged
+	}))
+	assert.For(ctx, "Build other").That(errors.Cause(err)).Equals(errUnplugged)
+	assert.For(ctx, "Attempts").That(attempts).Equals(3)
+}
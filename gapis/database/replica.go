@@ -0,0 +1,117 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+)
+
+// replicaQueueSize is the number of stores that can be waiting to be written
+// to a replica before stores to the primary block.
+const replicaQueueSize = 1024
+
+// WithReplica returns a Database that stores to primary, and mirrors each
+// store to replica in the background. Resolves are served by primary, falling
+// back to replica if primary fails to resolve the id, so replica can serve the
+// values lost by primary. Stores block once replicaQueueSize stores are
+// waiting to be written to replica.
+func WithReplica(primary, replica Database) Database {
+	d := &replicated{primary: primary, replica: replica}
+	d.drained = sync.NewCond(&d.mutex)
+	return d
+}
+
+type replicated struct {
+	primary Database
+	replica Database
+	mutex   sync.Mutex
+	drained *sync.Cond     // Signalled when stores are removed from queue
+	queue   []replicaStore // Stores waiting to be written to replica
+	writing bool           // True while a go-routine is writing the queue
+}
+
+type replicaStore struct {
+	ctx context.Context
+	id  id.ID
+	v   interface{}
+	m   proto.Message
+}
+
+// Implements Database
+func (d *replicated) store(ctx context.Context, id id.ID, v interface{}, m proto.Message) error {
+	if err := d.primary.store(ctx, id, v, m); err != nil {
+		return err
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for len(d.queue) >= replicaQueueSize {
+		d.drained.Wait()
+	}
+	// The write outlives the store, so must not be cancelled with ctx.
+	d.queue = append(d.queue, replicaStore{keys.Clone(context.Background(), ctx), id, v, m})
+	if !d.writing {
+		d.writing = true
+		go d.write()
+	}
+	return nil
+}
+
+// write writes the queued stores to the replica until the queue is empty.
+func (d *replicated) write() {
+	for {
+		d.mutex.Lock()
+		if len(d.queue) == 0 {
+			d.writing = false
+			d.mutex.Unlock()
+			return
+		}
+		s := d.queue[0]
+		d.queue = d.queue[1:]
+		d.drained.Broadcast()
+		d.mutex.Unlock()
+		if err := d.replica.store(s.ctx, s.id, s.v, s.m); err != nil {
+			log.W(s.ctx, "Failed to replicate %v: %v", s.id, err)
+		}
+	}
+}
+
+// Implements Database
+func (d *replicated) resolve(ctx context.Context, id id.ID) (interface{}, error) {
+	out, err := d.primary.resolve(ctx, id)
+	if err == nil {
+		return out, nil
+	}
+	if !d.replica.contains(ctx, id) {
+		return nil, err
+	}
+	log.D(ctx, "Resolving %v from replica: %v", id, err)
+	return d.replica.resolve(ctx, id)
+}
+
+// Implements Database
+func (d *replicated) contains(ctx context.Context, id id.ID) bool {
+	return d.primary.contains(ctx, id) || d.replica.contains(ctx, id)
+}
+
+// Implements normalizer
+func (d *replicated) normalize(m proto.Message) proto.Message {
+	return normalizeWith(d.primary, m)
+}
@@ -0,0 +1,59 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestReplica(t *testing.T) {
+	ctx := log.Testing(t)
+	replica := database.NewInMemory(ctx)
+	replicaCtx := database.Put(ctx, replica)
+	primaryCtx := database.Put(ctx, database.WithReplica(database.NewInMemory(ctx), replica))
+
+	ids := []id.ID{}
+	for i := 0; i < 2000; i++ {
+		i, err := database.Store(primaryCtx, &personV2{First: fmt.Sprint(i)})
+		assert.For(ctx, "Store").ThatError(err).Succeeded()
+		ids = append(ids, i)
+	}
+	// Wait for the replica to catch up.
+	for _, i := range ids {
+		_, err := database.Resolve(replicaCtx, i)
+		for start := time.Now(); err != nil && time.Since(start) < 10*time.Second; {
+			time.Sleep(time.Millisecond)
+			_, err = database.Resolve(replicaCtx, i)
+		}
+		assert.For(ctx, "Replicated").ThatError(err).Succeeded()
+	}
+
+	// Replace the primary with an empty database.
+	recoveredCtx := database.Put(ctx, database.WithReplica(database.NewInMemory(ctx), replica))
+	for n, i := range ids {
+		got, err := database.Resolve(recoveredCtx, i)
+		assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+		assert.For(ctx, "Value").That(got).DeepEquals(&personV2{First: fmt.Sprint(n)})
+	}
+	_, err := database.Resolve(recoveredCtx, id.OfString("missing"))
+	assert.For(ctx, "Resolve missing").ThatError(err).Failed()
+}
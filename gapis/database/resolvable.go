@@ -34,6 +34,25 @@ type Resolvable interface {
 	Resolve(ctx context.Context) (interface{}, error)
 }
 
+// Canonicalizer is the interface for resolvables that have a canonical form.
+// Resolvables that are encoded differently, but that build the same object,
+// can return the same canonical form so that they are stored with the same id
+// and share a single build. The database stores and hashes the canonical form
+// in place of the resolvable.
+type Canonicalizer interface {
+	// Canonicalize returns the canonical form of the resolvable.
+	Canonicalize() Resolvable
+}
+
+// canonicalize returns the canonical form of v if it is a Canonicalizer,
+// otherwise v.
+func canonicalize(v interface{}) interface{} {
+	if c, ok := v.(Canonicalizer); ok {
+		return c.Canonicalize()
+	}
+	return v
+}
+
 // resolvedID returns the identifier of a resolved object given the identifier
 // of the Resolvable.
 func resolvedID(in id.ID) id.ID {
@@ -0,0 +1,159 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/gapid/core/data/id"
+	"github.com/pkg/errors"
+)
+
+// ResolveHandler returns a http.Handler that serves the blobs held by db for
+// GET /resolve/{id} requests, where id can be any id accepted by
+// ResolveReader. Blobs are streamed as they are resolved, so the response
+// uses chunked transfer encoding rather than buffering the whole blob. A
+// single byte range can be requested with the Range header, and is served as
+// a partial response. Responses for content ids can be cached forever, but
+// ids whose value can change, such as aliases and computed ids, are served
+// with an ETag of the blob's content id and must be revalidated.
+// Ids that are not stored are served as 404, ids the caller is not allowed to
+// resolve as 403, and any other failure as 500.
+func ResolveHandler(db Database) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		i, err := id.Parse(strings.TrimPrefix(r.URL.Path, "/resolve/"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ctx := Put(r.Context(), db)
+		reader, size, err := ResolveReader(ctx, i)
+		if err != nil {
+			http.Error(w, err.Error(), resolveStatus(err))
+			return
+		}
+		content, err := contentID(ctx, i)
+		if err != nil {
+			http.Error(w, err.Error(), resolveStatus(err))
+			return
+		}
+
+		h := w.Header()
+		h.Set("Accept-Ranges", "bytes")
+		if content == i {
+			h.Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			h.Set("Cache-Control", "no-cache")
+		}
+		h.Set("Content-Type", "application/octet-stream")
+		h.Set("ETag", fmt.Sprintf(`"%v"`, content))
+
+		spec := r.Header.Get("Range")
+		if spec == "" {
+			io.Copy(w, reader)
+			return
+		}
+		start, end, ok := parseRange(spec, size)
+		if !ok {
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			http.Error(w, "Range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if _, err := io.CopyN(ioutil.Discard, reader, int64(start)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, size))
+		h.Set("Content-Length", strconv.FormatUint(end-start, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		io.CopyN(w, reader, int64(end-start))
+	})
+}
+
+// resolveStatus returns the HTTP status code for an error returned when
+// resolving a blob.
+func resolveStatus(err error) int {
+	switch errors.Cause(err) {
+	case ErrNotFound:
+		return http.StatusNotFound
+	case ErrForbidden:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// contentID returns the hash of the blob that id resolves to. This is id
+// itself for a content id, but differs for aliases and for ids whose value is
+// computed, as these can resolve to different blobs over time.
+func contentID(ctx context.Context, id id.ID) (id.ID, error) {
+	v, err := Resolve(ctx, id)
+	if err != nil {
+		return id, err
+	}
+	return Hash(ctx, v)
+}
+
+// parseRange returns the half-open byte range [start, end) requested by the
+// Range header spec for a blob of size bytes. parseRange returns false if spec
+// is not a single satisfiable byte range.
+func parseRange(spec string, size uint64) (start, end uint64, ok bool) {
+	spec = strings.TrimPrefix(spec, "bytes=")
+	parts := strings.Split(spec, "-")
+	if len(parts) != 2 || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	switch {
+	case first == "": // Suffix range: the last n bytes.
+		n, err := strconv.ParseUint(last, 10, 64)
+		if err != nil || n == 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size, size > 0
+	case last == "": // Open range: from first to the end.
+		s, err := strconv.ParseUint(first, 10, 64)
+		if err != nil || s >= size {
+			return 0, 0, false
+		}
+		return s, size, true
+	default:
+		s, err := strconv.ParseUint(first, 10, 64)
+		if err != nil || s >= size {
+			return 0, 0, false
+		}
+		e, err := strconv.ParseUint(last, 10, 64)
+		if err != nil || e < s {
+			return 0, 0, false
+		}
+		if e >= size {
+			e = size - 1
+		}
+		return s, e + 1, true
+	}
+}
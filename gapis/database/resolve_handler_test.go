@@ -0,0 +1,120 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestResolveHandler(t *testing.T) {
+	ctx := log.Testing(t)
+	d := database.NewInMemory(ctx)
+	ctx = database.Put(ctx, d)
+
+	data := make([]byte, 256<<10)
+	rand.New(rand.NewSource(5)).Read(data)
+	i, err := database.StoreChunked(ctx, data)
+	assert.For(ctx, "StoreChunked").ThatError(err).Succeeded()
+
+	server := httptest.NewServer(database.ResolveHandler(d))
+	defer server.Close()
+	get := func(byteRange string) (*http.Response, []byte) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%v/resolve/%v", server.URL, i), nil)
+		assert.For(ctx, "NewRequest").ThatError(err).Succeeded()
+		if byteRange != "" {
+			req.Header.Set("Range", byteRange)
+		}
+		res, err := http.DefaultClient.Do(req)
+		assert.For(ctx, "Get").ThatError(err).Succeeded()
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		assert.For(ctx, "ReadAll").ThatError(err).Succeeded()
+		return res, body
+	}
+
+	res, body := get("")
+	assert.For(ctx, "Status").That(res.StatusCode).Equals(http.StatusOK)
+	assert.For(ctx, "Chunked").ThatSlice(res.TransferEncoding).Equals([]string{"chunked"})
+	assert.For(ctx, "Body").That(bytes.Equal(body, data)).Equals(true)
+
+	res, body = get("bytes=100000-100999")
+	assert.For(ctx, "Range status").That(res.StatusCode).Equals(http.StatusPartialContent)
+	assert.For(ctx, "Content-Range").That(res.Header.Get("Content-Range")).
+		Equals(fmt.Sprintf("bytes 100000-100999/%d", len(data)))
+	assert.For(ctx, "Range body").That(bytes.Equal(body, data[100000:101000])).Equals(true)
+
+	res, body = get("bytes=-10")
+	assert.For(ctx, "Suffix status").That(res.StatusCode).Equals(http.StatusPartialContent)
+	assert.For(ctx, "Suffix body").That(bytes.Equal(body, data[len(data)-10:])).Equals(true)
+
+	res, _ = get(fmt.Sprintf("bytes=%d-", len(data)))
+	assert.For(ctx, "Unsatisfiable").That(res.StatusCode).Equals(http.StatusRequestedRangeNotSatisfiable)
+}
+
+func TestResolveHandlerStatus(t *testing.T) {
+	ctx := log.Testing(t)
+	d := database.NewInMemory(ctx)
+	ctx = database.Put(ctx, d)
+
+	i, err := database.StoreChunked(ctx, []byte("hello"))
+	assert.For(ctx, "StoreChunked").ThatError(err).Succeeded()
+	alias := id.OfString("alias")
+	assert.For(ctx, "Alias").ThatError(database.Alias(ctx, alias, i)).Succeeded()
+	forbidden, err := database.StoreChunked(ctx, []byte("secret"))
+	assert.For(ctx, "StoreChunked").ThatError(err).Succeeded()
+
+	authorize := func(ctx context.Context, i id.ID) error {
+		if i == forbidden {
+			return database.ErrForbidden
+		}
+		return nil
+	}
+	server := httptest.NewServer(database.ResolveHandler(database.WithAccessControl(d, authorize)))
+	defer server.Close()
+	get := func(i id.ID) *http.Response {
+		res, err := http.Get(fmt.Sprintf("%v/resolve/%v", server.URL, i))
+		assert.For(ctx, "Get").ThatError(err).Succeeded()
+		res.Body.Close()
+		return res
+	}
+
+	res := get(i)
+	assert.For(ctx, "Content status").That(res.StatusCode).Equals(http.StatusOK)
+	assert.For(ctx, "Content cache").That(res.Header.Get("Cache-Control")).
+		Equals("public, max-age=31536000, immutable")
+
+	res = get(alias)
+	assert.For(ctx, "Alias status").That(res.StatusCode).Equals(http.StatusOK)
+	assert.For(ctx, "Alias cache").That(res.Header.Get("Cache-Control")).Equals("no-cache")
+	assert.For(ctx, "Alias ETag").That(res.Header.Get("ETag")).Equals(fmt.Sprintf(`"%v"`, i))
+
+	res = get(id.OfString("missing"))
+	assert.For(ctx, "Missing status").That(res.StatusCode).Equals(http.StatusNotFound)
+
+	res = get(forbidden)
+	assert.For(ctx, "Forbidden status").That(res.StatusCode).Equals(http.StatusForbidden)
+}
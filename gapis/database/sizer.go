@@ -0,0 +1,62 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Sizer is the interface implemented by values that can report the number of
+// bytes they retain in memory. Values that do not implement Sizer are
+// accounted using the size of their proto encoding, which can understate the
+// cost of decoded objects holding pointers, slices or maps. Built values that
+// cannot be encoded are accounted using the size of the stored proto that
+// built them.
+type Sizer interface {
+	// SizeBytes returns the number of bytes retained by the value.
+	SizeBytes() uint64
+}
+
+// sizeBytes returns the accounted size of the record's value in bytes.
+func (r *record) sizeBytes() uint64 {
+	switch o := r.object.(type) {
+	case Sizer:
+		return o.SizeBytes()
+	case proto.Message:
+		return uint64(proto.Size(o))
+	}
+	if r.recomputable {
+		// The object was built by a resolvable, so the stored proto is the
+		// resolvable, not the object.
+		if m, err := toProto(context.Background(), r.object); err == nil {
+			return uint64(proto.Size(m))
+		}
+	}
+	return uint64(proto.Size(r.proto))
+}
+
+// resizeLocked updates the accounted size of r and the database.
+// resizeLocked must be called with a locked mutex.
+func (d *memory) resizeLocked(r *record) {
+	size, built := r.sizeBytes()+uint64(len(r.encoded)), uint64(0)
+	if r.recomputable {
+		built = size
+	}
+	d.size += size - r.size
+	d.builtSize += built - r.builtSize
+	r.size, r.builtSize = size, built
+}
@@ -0,0 +1,82 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+)
+
+// decodedState is a proto-less value that reports its retained size.
+type decodedState struct{ retained uint64 }
+
+func (s decodedState) SizeBytes() uint64 { return s.retained }
+
+// stateResolvable resolves to a decodedState.
+type stateResolvable struct {
+	Retained uint64 `protobuf:"varint,1,opt,name=retained"`
+}
+
+func (m *stateResolvable) Reset()         { *m = stateResolvable{} }
+func (m *stateResolvable) String() string { return proto.CompactTextString(m) }
+func (*stateResolvable) ProtoMessage()    {}
+
+func (m *stateResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	return decodedState{m.Retained}, nil
+}
+
+func TestSizerAccounting(t *testing.T) {
+	ctx := log.Testing(t)
+	d := NewInMemory(ctx).(*memory)
+	ctx = Put(ctx, d)
+
+	r := &stateResolvable{Retained: 1 << 20}
+	i, err := Store(ctx, r)
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	assert.For(ctx, "Stored size").That(d.size).Equals(uint64(proto.Size(r)))
+
+	_, err = Resolve(ctx, i)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	assert.For(ctx, "Resolved size").That(d.size).Equals(uint64(1 << 20))
+}
+
+// blobResolvable resolves to a []byte of Size bytes.
+type blobResolvable struct {
+	Size uint64 `protobuf:"varint,1,opt,name=size"`
+}
+
+func (m *blobResolvable) Reset()         { *m = blobResolvable{} }
+func (m *blobResolvable) String() string { return proto.CompactTextString(m) }
+func (*blobResolvable) ProtoMessage()    {}
+
+func (m *blobResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	return make([]byte, m.Size), nil
+}
+
+func TestEncodedSizeAccounting(t *testing.T) {
+	ctx := log.Testing(t)
+	d := NewInMemory(ctx).(*memory)
+	ctx = Put(ctx, d)
+
+	i, err := Store(ctx, &blobResolvable{Size: 1 << 20})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	_, err = Resolve(ctx, i)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	assert.For(ctx, "Resolved size").That(d.size >= 1<<20).Equals(true)
+}
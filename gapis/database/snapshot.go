@@ -0,0 +1,83 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/gapid/core/context/keys"
+)
+
+// Snapshot returns a context whose resolves pin the values they resolve, and
+// a function that releases the pins. Until released, pinned values are not
+// evicted, reclaimed, expired or refreshed, so a set of values resolved with
+// the context stays consistent however long the resolves take. Only the
+// values resolved directly with the returned context are pinned. Values
+// resolved by resolvables while building are not.
+// The release function must be called once the values are no longer needed.
+func Snapshot(ctx context.Context) (context.Context, func()) {
+	s := &snapshot{pinned: map[*record]*memory{}}
+	return keys.WithValue(ctx, snapshotKey, s), s.release
+}
+
+type snapshotKeyTy string
+
+const snapshotKey = snapshotKeyTy("snapshot")
+
+// snapshot holds the records pinned by the resolves of a Snapshot context.
+type snapshot struct {
+	mutex    sync.Mutex
+	pinned   map[*record]*memory // The database of each pinned record
+	released bool
+}
+
+// pinLocked pins r, held by d, in the snapshot held by ctx, if any.
+// pinLocked must be called with d's mutex locked.
+func (d *memory) pinLocked(ctx context.Context, r *record) {
+	s, ok := ctx.Value(snapshotKey).(*snapshot)
+	if !ok {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.released || s.pinned[r] != nil {
+		return
+	}
+	s.pinned[r] = d
+	r.pins++
+}
+
+func (s *snapshot) release() {
+	s.mutex.Lock()
+	pinned := s.pinned
+	s.pinned, s.released = nil, true
+	s.mutex.Unlock()
+
+	byDatabase := map[*memory][]*record{}
+	for r, d := range pinned {
+		byDatabase[d] = append(byDatabase[d], r)
+	}
+	for d, records := range byDatabase {
+		d.mutex.Lock()
+		for _, r := range records {
+			r.pins--
+		}
+		if d.policy != nil {
+			d.evictLocked()
+		}
+		d.mutex.Unlock()
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestSnapshot(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewMemoryDatabaseWithPolicy(ctx, 250, database.NewLRU()))
+
+	ids := []id.ID{}
+	for i := 0; i < 4; i++ {
+		r, err := database.Store(ctx, newResolvable(fmt.Sprint("snapshot-", i), func(context.Context) (interface{}, error) {
+			return sizedValue{100}, nil
+		}))
+		assert.For(ctx, "Store").ThatError(err).Succeeded()
+		ids = append(ids, r)
+	}
+	cached := func(i id.ID) bool {
+		_, ok, err := database.ResolveCachedOnly(ctx, i)
+		assert.For(ctx, "ResolveCachedOnly").ThatError(err).Succeeded()
+		return ok
+	}
+
+	snapshotCtx, release := database.Snapshot(ctx)
+	_, err := database.Resolve(snapshotCtx, ids[0])
+	assert.For(ctx, "Resolve in snapshot").ThatError(err).Succeeded()
+
+	// Build enough values to force the least recently used value out.
+	for _, i := range ids[1:] {
+		_, err := database.Resolve(ctx, i)
+		assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	}
+	assert.For(ctx, "Pinned value cached").That(cached(ids[0])).Equals(true)
+	assert.For(ctx, "Unpinned value evicted").That(cached(ids[1])).Equals(false)
+
+	release()
+	_, err = database.Resolve(ctx, ids[1])
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	assert.For(ctx, "Released value evicted").That(cached(ids[0])).Equals(false)
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+)
+
+// WithStaleWhileRevalidate returns an Option that keeps serving a value built
+// by a Resolvable once it is older than staleAfter, while rebuilding the value
+// in the background. Later resolves return the rebuilt value.
+// Only one rebuild of a value runs at a time.
+func WithStaleWhileRevalidate(staleAfter time.Duration) Option {
+	return func(m *memory) { m.staleAfter = staleAfter }
+}
+
+// revalidateLocked starts a background rebuild of the value resolved by rs if
+// the value is stale and is not already being rebuilt. The rebuild is built
+// like any other resolve, with the resolve timeout, watchdog and pool of the
+// database, and is traced if the resolve made with ctx is traced. Rebuilds
+// wait for a pool slot at Low priority.
+// revalidateLocked must be called with a locked mutex.
+func (d *memory) revalidateLocked(ctx context.Context, id id.ID, r *record, rs *resolveState) {
+	if !r.recomputable || rs.refreshing || r.pins > 0 || time.Since(rs.built) < d.staleAfter {
+		return
+	}
+	rs.refreshing = true
+	fresh := &record{proto: r.proto, storedType: r.storedType}
+	typename := rs.typename
+	refresh := func(ctx context.Context) {
+		defer d.resolvePanicHandler(ctx)
+		if d.watchdog > 0 {
+			defer d.watch(ctx, id, typename)()
+		}
+		policy, err := d.resolveWithTimeout(ctx, fresh)
+
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		rs.refreshing = false
+		if err != nil {
+			log.W(ctx, "Failed to refresh %v: %v", id, err)
+			return // Keep serving the stale value.
+		}
+		if r.resolveState != rs {
+			return // The value was discarded while refreshing.
+		}
+		r.object, rs.value, rs.built = fresh.object, fresh.object, time.Now()
+		rs.expires = policy.expires(rs.built)
+		d.resizeLocked(r)
+		d.digestLocked(r, rs)
+		d.notifyLocked(id, Recomputed)
+	}
+	refreshCtx := (&resolveChain{r, nil}).bind(r.bindParams(d.resolveCtx))
+	if t := traceOf(ctx); t != nil {
+		refreshCtx, refresh = t.bind(refreshCtx), t.traced(id, typename, refresh)
+	}
+	if d.pool == nil {
+		go refresh(refreshCtx)
+	} else {
+		d.scheduleBackgroundLocked(func() { refresh(refreshCtx) })
+	}
+}
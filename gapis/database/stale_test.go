@@ -0,0 +1,114 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+var (
+	versionCount int32
+	versionGate  chan struct{}
+)
+
+// versionResolvable resolves to the number of times it has been resolved.
+// Every resolve after the first blocks until versionGate is closed.
+type versionResolvable struct {
+	Name string `protobuf:"bytes,1,opt,name=name"`
+}
+
+func (m *versionResolvable) Reset()         { *m = versionResolvable{} }
+func (m *versionResolvable) String() string { return proto.CompactTextString(m) }
+func (*versionResolvable) ProtoMessage()    {}
+
+func (m *versionResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	n := atomic.AddInt32(&versionCount, 1)
+	if n > 1 {
+		<-versionGate
+	}
+	return n, nil
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	ctx := log.Testing(t)
+	atomic.StoreInt32(&versionCount, 0)
+	staleAfter := 100 * time.Millisecond
+	ctx = database.Put(ctx, database.NewInMemory(ctx, database.WithStaleWhileRevalidate(staleAfter)))
+	versionGate = make(chan struct{})
+
+	i, err := database.Store(ctx, &versionResolvable{Name: "stale"})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+
+	resolve := func() int32 {
+		got, err := database.Resolve(ctx, i)
+		assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+		return got.(int32)
+	}
+
+	assert.For(ctx, "First resolve").That(resolve()).Equals(int32(1))
+	time.Sleep(2 * staleAfter)
+
+	// The refresh is blocked on the gate, so a burst of resolves all get the
+	// stale value without starting any more refreshes.
+	for j := 0; j < 10; j++ {
+		assert.For(ctx, "Stale resolve").That(resolve()).Equals(int32(1))
+	}
+	close(versionGate)
+
+	deadline := time.Now().Add(5 * time.Second)
+	got := resolve()
+	for got == 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		got = resolve()
+	}
+	assert.For(ctx, "Refreshed resolve").That(got).Equals(int32(2))
+	assert.For(ctx, "Resolve count").That(atomic.LoadInt32(&versionCount)).Equals(int32(2))
+}
+
+func TestStaleRevalidateTimeout(t *testing.T) {
+	ctx := log.Testing(t)
+	atomic.StoreInt32(&versionCount, 0)
+	staleAfter := 10 * time.Millisecond
+	ctx = database.Put(ctx, database.NewInMemory(ctx, database.WithStaleWhileRevalidate(staleAfter)))
+	versionGate = make(chan struct{})
+	defer close(versionGate)
+
+	versionType := reflect.TypeOf(&versionResolvable{})
+	database.SetResolveTimeout(versionType, 20*time.Millisecond)
+	defer database.SetResolveTimeout(versionType, 0)
+
+	i, err := database.Store(ctx, &versionResolvable{Name: "stale-timeout"})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+
+	// Refreshes are blocked on the gate, but time out, so later resolves of
+	// the stale value start new refreshes.
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&versionCount) < 3 && time.Now().Before(deadline) {
+		got, err := database.Resolve(ctx, i)
+		assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+		assert.For(ctx, "Stale value").That(got).Equals(int32(1))
+		time.Sleep(staleAfter)
+	}
+	assert.For(ctx, "Refreshes").That(atomic.LoadInt32(&versionCount) >= 3).Equals(true)
+}
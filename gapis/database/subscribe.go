@@ -0,0 +1,214 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/gapid/core/data/id"
+)
+
+// subscriptionBuffer is the number of events buffered for each subscription
+// before events are dropped.
+const subscriptionBuffer = 64
+
+// EntryEventKind is the type of an EntryEvent.
+type EntryEventKind int
+
+const (
+	// Stored is sent when the entry is stored.
+	Stored EntryEventKind = iota
+	// Resolved is sent when the entry is resolved for the first time.
+	Resolved
+	// Evicted is sent when the value built for the entry is discarded.
+	Evicted
+	// Recomputed is sent when the value for the entry is built again.
+	Recomputed
+	// Hit is sent when a resolve of the entry uses the cached value. Hit is
+	// only sent to taps, see Tap.
+	Hit
+)
+
+func (k EntryEventKind) String() string {
+	switch k {
+	case Stored:
+		return "Stored"
+	case Resolved:
+		return "Resolved"
+	case Evicted:
+		return "Evicted"
+	case Recomputed:
+		return "Recomputed"
+	case Hit:
+		return "Hit"
+	}
+	return "Unknown"
+}
+
+// EntryEvent is an event in the lifecycle of an entry.
+type EntryEvent struct {
+	// ID is the identifier of the entry.
+	ID id.ID
+	// Kind is the type of the event.
+	Kind EntryEventKind
+	// Time is the time of the event.
+	Time time.Time
+	// Dropped is the number of events that were dropped before this event as
+	// the subscriber was not receiving them fast enough.
+	Dropped uint64
+}
+
+// subscriber is the interface implemented by databases that can report the
+// lifecycle events of their entries.
+type subscriber interface {
+	subscribe(id.ID) (<-chan EntryEvent, func())
+}
+
+// Subscribe returns a channel that receives the lifecycle events of the entry
+// with the given id in the database held by the context, and a function that
+// ends the subscription and closes the channel. The id does not need to be
+// stored yet. Events are dropped rather than blocking the database if the
+// channel is not drained fast enough.
+// Databases that do not report lifecycle events return a closed channel.
+func Subscribe(ctx context.Context, id id.ID) (<-chan EntryEvent, func()) {
+	if s, ok := Get(ctx).(subscriber); ok {
+		return s.subscribe(id)
+	}
+	c := make(chan EntryEvent)
+	close(c)
+	return c, func() {}
+}
+
+// tapper is the interface implemented by databases that can report the
+// lifecycle events of all their entries.
+type tapper interface {
+	tap(buffer int) (<-chan EntryEvent, func())
+}
+
+// Tap returns a channel that receives the events of every entry in the
+// database held by the context, in the order they happen, and a function that
+// ends the tap and closes the channel. Unlike Subscribe, the events include a
+// Hit for each resolve that uses a cached value. The channel buffers up to
+// buffer events, after which events are dropped rather than blocking the
+// database, and counted in the Dropped field of the next event sent.
+// Databases that do not report lifecycle events return a closed channel.
+func Tap(ctx context.Context, buffer int) (<-chan EntryEvent, func()) {
+	if t, ok := Get(ctx).(tapper); ok {
+		return t.tap(buffer)
+	}
+	c := make(chan EntryEvent)
+	close(c)
+	return c, func() {}
+}
+
+type subscription struct {
+	c       chan EntryEvent
+	dropped uint64 // Events dropped since the last sent event
+}
+
+// Implements subscriber
+func (d *memory) subscribe(id id.ID) (<-chan EntryEvent, func()) {
+	s := &subscription{c: make(chan EntryEvent, subscriptionBuffer)}
+	d.mutex.Lock()
+	d.subscribers[id] = append(d.subscribers[id], s)
+	d.mutex.Unlock()
+	unsubscribe := func() {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		subs := d.subscribers[id]
+		for i, o := range subs {
+			if o == s {
+				subs = append(subs[:i], subs[i+1:]...)
+				close(s.c)
+				break
+			}
+		}
+		if len(subs) == 0 {
+			delete(d.subscribers, id)
+		} else {
+			d.subscribers[id] = subs
+		}
+	}
+	return s.c, unsubscribe
+}
+
+// Implements tapper
+func (d *memory) tap(buffer int) (<-chan EntryEvent, func()) {
+	s := &subscription{c: make(chan EntryEvent, buffer)}
+	d.mutex.Lock()
+	d.taps = append(d.taps, s)
+	d.mutex.Unlock()
+	untap := func() {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		for i, o := range d.taps {
+			if o == s {
+				d.taps = append(d.taps[:i], d.taps[i+1:]...)
+				close(s.c)
+				break
+			}
+		}
+	}
+	return s.c, untap
+}
+
+// notifyResolvedLocked sends the event for a successful resolve of r.
+// notifyResolvedLocked must be called with a locked mutex.
+func (d *memory) notifyResolvedLocked(id id.ID, r *record) {
+	if r.resolved {
+		d.notifyLocked(id, Recomputed)
+	} else {
+		r.resolved = true
+		d.notifyLocked(id, Resolved)
+	}
+}
+
+// notifyLocked sends an event of the given kind to the subscribers of id and
+// to the taps.
+// notifyLocked must be called with a locked mutex.
+func (d *memory) notifyLocked(id id.ID, kind EntryEventKind) {
+	if subs := d.subscribers[id]; len(subs) > 0 {
+		now := time.Now()
+		for _, s := range subs {
+			s.send(EntryEvent{ID: id, Kind: kind, Time: now})
+		}
+	}
+	d.tapLocked(id, kind)
+}
+
+// tapLocked sends an event of the given kind to the taps.
+// tapLocked must be called with a locked mutex.
+func (d *memory) tapLocked(id id.ID, kind EntryEventKind) {
+	if len(d.taps) == 0 {
+		return
+	}
+	now := time.Now()
+	for _, s := range d.taps {
+		s.send(EntryEvent{ID: id, Kind: kind, Time: now})
+	}
+}
+
+// send sends e on the subscription's channel, or drops it if the channel is
+// full.
+func (s *subscription) send(e EntryEvent) {
+	e.Dropped = s.dropped
+	select {
+	case s.c <- e:
+		s.dropped = 0
+	default:
+		s.dropped++
+	}
+}
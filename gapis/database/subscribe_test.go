@@ -0,0 +1,105 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestSubscribe(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	r := &policyResolvable{Policy: "no-cache"}
+	i, err := database.Hash(ctx, r)
+	assert.For(ctx, "Hash").ThatError(err).Succeeded()
+	events, unsubscribe := database.Subscribe(ctx, i)
+
+	_, err = database.Store(ctx, r)
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	for j := 0; j < 2; j++ {
+		_, err = database.Resolve(ctx, i)
+		assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	}
+	unsubscribe()
+
+	kinds := []database.EntryEventKind{}
+	for e := range events {
+		assert.For(ctx, "Event id").That(e.ID).Equals(i)
+		assert.For(ctx, "Dropped").That(e.Dropped).Equals(uint64(0))
+		kinds = append(kinds, e.Kind)
+	}
+	assert.For(ctx, "Events").ThatSlice(kinds).Equals([]database.EntryEventKind{
+		database.Stored, database.Resolved, database.Evicted, database.Recomputed,
+	})
+}
+
+func TestTap(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	events, untap := database.Tap(ctx, 16)
+
+	cached, err := database.Store(ctx, &policyResolvable{Policy: "default"})
+	assert.For(ctx, "Store cached").ThatError(err).Succeeded()
+	uncached, err := database.Store(ctx, &policyResolvable{Policy: "no-cache"})
+	assert.For(ctx, "Store uncached").ThatError(err).Succeeded()
+	for _, i := range []id.ID{cached, cached, uncached, uncached} {
+		_, err = database.Resolve(ctx, i)
+		assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	}
+	untap()
+
+	type event struct {
+		ID   id.ID
+		Kind database.EntryEventKind
+	}
+	got := []event{}
+	for e := range events {
+		assert.For(ctx, "Dropped").That(e.Dropped).Equals(uint64(0))
+		got = append(got, event{e.ID, e.Kind})
+	}
+	assert.For(ctx, "Events").ThatSlice(got).Equals([]event{
+		{cached, database.Stored},
+		{uncached, database.Stored},
+		{cached, database.Resolved},
+		{cached, database.Hit},
+		{uncached, database.Resolved},
+		{uncached, database.Evicted},
+		{uncached, database.Recomputed},
+	})
+}
+
+func TestTapDrops(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	events, untap := database.Tap(ctx, 1)
+
+	for _, name := range []string{"a", "b", "c"} {
+		_, err := database.Store(ctx, &personV2{First: name})
+		assert.For(ctx, "Store").ThatError(err).Succeeded()
+	}
+	first := <-events
+	assert.For(ctx, "First dropped").That(first.Dropped).Equals(uint64(0))
+	_, err := database.Store(ctx, &personV2{First: "d"})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	untap()
+	last := <-events
+	assert.For(ctx, "Last dropped").That(last.Dropped).Equals(uint64(2))
+}
@@ -0,0 +1,107 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+)
+
+// ErrResolveTimeout is returned by resolves that take longer than the timeout
+// set for their type with SetResolveTimeout.
+const ErrResolveTimeout = fault.Const("Resolve timed out")
+
+var (
+	timeoutsMutex sync.RWMutex
+	timeouts      = map[reflect.Type]time.Duration{}
+)
+
+// SetResolveTimeout sets the longest time that resolvables of resolvableType
+// may take to build their value. Resolves that take longer fail with
+// ErrResolveTimeout, naming the type. The context passed to the resolvable is
+// cancelled once the timeout elapses, so resolvables that watch their context
+// stop early. Setting a timeout of 0 removes the timeout for the type.
+// Resolvables of types without a timeout are not limited.
+func SetResolveTimeout(resolvableType reflect.Type, d time.Duration) {
+	timeoutsMutex.Lock()
+	defer timeoutsMutex.Unlock()
+	if d <= 0 {
+		delete(timeouts, resolvableType)
+	} else {
+		timeouts[resolvableType] = d
+	}
+}
+
+// resolveTimeoutFor returns the timeout set for resolvables of type ty, or 0
+// if they have no timeout.
+func resolveTimeoutFor(ty reflect.Type) time.Duration {
+	timeoutsMutex.RLock()
+	defer timeoutsMutex.RUnlock()
+	return timeouts[ty]
+}
+
+// resolveWithTimeout builds the value of r, failing with ErrResolveTimeout if
+// the build takes longer than the timeout set for the type stored in r.
+// Timed builds run on their own go-routine, so the timeout is reported on time
+// even if the resolvable ignores its context. A build that outlives its
+// timeout runs to completion, but its value is discarded.
+func (d *memory) resolveWithTimeout(ctx context.Context, r *record) (CachePolicy, error) {
+	timeout := resolveTimeoutFor(r.storedType)
+	if timeout == 0 {
+		return d.resolveWithRecovery(ctx, r)
+	}
+	ctx, cancel := task.WithTimeout(ctx, timeout)
+	defer cancel()
+	timedOut := func() error {
+		return log.Errf(ctx, ErrResolveTimeout, "Resolve of %v took longer than %v", r.storedType, timeout)
+	}
+
+	// Build into a copy of the record, as r must not be modified once the
+	// timeout has been reported.
+	b := &record{proto: r.proto, object: r.object, storedType: r.storedType}
+	var policy CachePolicy
+	var err error
+	var panicked interface{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() { panicked = recover() }()
+		policy, err = d.resolveWithRecovery(ctx, b)
+	}()
+
+	select {
+	case <-done:
+		if panicked != nil {
+			// Re-raise on the caller's go-routine, for resolvePanicHandler.
+			panic(panicked)
+		}
+		r.object, r.recomputable = b.object, r.recomputable || b.recomputable
+		if ctx.Err() == context.DeadlineExceeded {
+			return policy, timedOut()
+		}
+		return policy, err
+	case <-task.ShouldStop(ctx):
+		if ctx.Err() == context.DeadlineExceeded {
+			return DefaultCache, timedOut()
+		}
+		return DefaultCache, ctx.Err()
+	}
+}
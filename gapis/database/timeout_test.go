@@ -0,0 +1,69 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+	"github.com/pkg/errors"
+)
+
+// slowResolvable takes a second to resolve, ignoring its context.
+type slowResolvable struct {
+	Name string `protobuf:"bytes,1,opt,name=name"`
+}
+
+func (m *slowResolvable) Reset()         { *m = slowResolvable{} }
+func (m *slowResolvable) String() string { return proto.CompactTextString(m) }
+func (*slowResolvable) ProtoMessage()    {}
+
+func (m *slowResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	time.Sleep(time.Second)
+	return m.Name, nil
+}
+
+func TestSetResolveTimeout(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	slowType := reflect.TypeOf(&slowResolvable{})
+	database.SetResolveTimeout(slowType, 10*time.Millisecond)
+	defer database.SetResolveTimeout(slowType, 0)
+
+	slow, err := database.Store(ctx, &slowResolvable{Name: "slow"})
+	assert.For(ctx, "Store slow").ThatError(err).Succeeded()
+	start := time.Now()
+	_, err = database.Resolve(ctx, slow)
+	assert.For(ctx, "Slow").That(errors.Cause(err)).Equals(database.ErrResolveTimeout)
+	assert.For(ctx, "Returned on time").That(time.Since(start) < 500*time.Millisecond).Equals(true)
+	assert.For(ctx, "Slow message").ThatString(err.Error()).Contains("slowResolvable")
+
+	// Types without a timeout are not limited.
+	unbounded, err := database.Store(ctx, newResolvable("timeout-unbounded", func(context.Context) (interface{}, error) {
+		time.Sleep(50 * time.Millisecond)
+		return "done", nil
+	}))
+	assert.For(ctx, "Store unbounded").ThatError(err).Succeeded()
+	got, err := database.Resolve(ctx, unbounded)
+	assert.For(ctx, "Unbounded").ThatError(err).Succeeded()
+	assert.For(ctx, "Unbounded value").That(got).Equals("done")
+}
@@ -17,6 +17,7 @@ package database
 import (
 	"context"
 	"reflect"
+	"sync"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/google/gapid/core/data/pod"
@@ -24,11 +25,68 @@ import (
 	"github.com/google/gapid/core/log"
 )
 
+var (
+	convertersMutex sync.RWMutex
+	converters      = map[reflect.Type]func(interface{}) (proto.Message, error){}
+	reverse         = map[reflect.Type]func(proto.Message) (interface{}, error){}
+)
+
+// RegisterProtoConverter registers fn as the function used to convert values
+// of goType to proto messages when they are stored or hashed.
+// Registered converters are called directly, bypassing the reflection used by
+// the protoconv converters, and so should be used for frequently stored types.
+// Values read back from protos, such as those copied with CopyWithRemap or
+// served by ReplayDatabase, are only converted back to goType if the proto
+// type has a converter registered with RegisterProtoReverseConverter or
+// protoconv. Otherwise the proto message is returned.
+func RegisterProtoConverter(goType reflect.Type, fn func(interface{}) (proto.Message, error)) {
+	convertersMutex.Lock()
+	defer convertersMutex.Unlock()
+	converters[goType] = fn
+}
+
+// RegisterProtoReverseConverter registers fn as the function used to convert
+// proto messages of protoType back to the Go value they were built from. It is
+// the reverse of the converter registered with RegisterProtoConverter, and
+// takes precedence over any protoconv converter for protoType.
+func RegisterProtoReverseConverter(protoType reflect.Type, fn func(proto.Message) (interface{}, error)) {
+	convertersMutex.Lock()
+	defer convertersMutex.Unlock()
+	reverse[protoType] = fn
+}
+
+// fromProto converts m to its Go type using the reverse converters registered
+// with RegisterProtoConverter, falling back to protoconv.ToObject.
+func fromProto(ctx context.Context, m proto.Message) (interface{}, error) {
+	convertersMutex.RLock()
+	fn, ok := reverse[reflect.TypeOf(m)]
+	convertersMutex.RUnlock()
+	if ok {
+		obj, err := fn(m)
+		if err != nil {
+			return nil, log.Errf(ctx, err, "Failed to convert %T from proto", m)
+		}
+		return obj, nil
+	}
+	return protoconv.ToObject(ctx, m)
+}
+
 func toProto(ctx context.Context, v interface{}) (proto.Message, error) {
 	// If v is a proto message, then there's no work to do.
 	if v, ok := v.(proto.Message); ok {
 		return v, nil
 	}
+	// Check the directly registered converters.
+	convertersMutex.RLock()
+	fn, ok := converters[reflect.TypeOf(v)]
+	convertersMutex.RUnlock()
+	if ok {
+		msg, err := fn(v)
+		if err != nil {
+			return nil, log.Errf(ctx, err, "Failed to convert %T to proto", v)
+		}
+		return msg, nil
+	}
 	if b := pod.NewValue(v); b != nil {
 		return b, nil
 	}
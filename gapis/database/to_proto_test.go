@@ -0,0 +1,125 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/data/protoconv"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+type nameProto struct {
+	First string `protobuf:"bytes,1,opt,name=first"`
+	Last  string `protobuf:"bytes,2,opt,name=last"`
+}
+
+func (m *nameProto) Reset()         { *m = nameProto{} }
+func (m *nameProto) String() string { return proto.CompactTextString(m) }
+func (*nameProto) ProtoMessage()    {}
+
+// reflectedName is converted to a proto using protoconv.
+type reflectedName struct{ first, last string }
+
+// directName is converted to a proto using database.RegisterProtoConverter.
+type directName struct{ first, last string }
+
+// roundTripName is converted to and from a proto using the directly
+// registered converters.
+type roundTripName struct{ first, last string }
+
+type roundTripProto struct {
+	First string `protobuf:"bytes,1,opt,name=first"`
+	Last  string `protobuf:"bytes,2,opt,name=last"`
+}
+
+func (m *roundTripProto) Reset()         { *m = roundTripProto{} }
+func (m *roundTripProto) String() string { return proto.CompactTextString(m) }
+func (*roundTripProto) ProtoMessage()    {}
+
+func init() {
+	protoconv.Register(
+		func(ctx context.Context, n *reflectedName) (*nameProto, error) {
+			return &nameProto{First: n.first, Last: n.last}, nil
+		},
+		func(ctx context.Context, p *nameProto) (*reflectedName, error) {
+			return &reflectedName{p.First, p.Last}, nil
+		},
+	)
+	database.RegisterProtoConverter(reflect.TypeOf(&directName{}), func(v interface{}) (proto.Message, error) {
+		n := v.(*directName)
+		return &nameProto{First: n.first, Last: n.last}, nil
+	})
+	database.RegisterProtoConverter(reflect.TypeOf(&roundTripName{}), func(v interface{}) (proto.Message, error) {
+		n := v.(*roundTripName)
+		return &roundTripProto{First: n.first, Last: n.last}, nil
+	})
+	database.RegisterProtoReverseConverter(reflect.TypeOf(&roundTripProto{}), func(m proto.Message) (interface{}, error) {
+		p := m.(*roundTripProto)
+		return &roundTripName{p.First, p.Last}, nil
+	})
+}
+
+func TestRegisterProtoConverter(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	direct, err := database.Store(ctx, &directName{"Grace", "Hopper"})
+	assert.For(ctx, "Store direct").ThatError(err).Succeeded()
+	other, err := database.Store(ctx, &directName{"Alan", "Turing"})
+	assert.For(ctx, "Store other").ThatError(err).Succeeded()
+	assert.For(ctx, "Distinct ids").That(direct == other).Equals(false)
+	got, err := database.Resolve(ctx, direct)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	assert.For(ctx, "Resolved").That(got).DeepEquals(&directName{"Grace", "Hopper"})
+}
+
+func TestRegisterProtoReverseConverter(t *testing.T) {
+	ctx := log.Testing(t)
+	src, dst := database.NewInMemory(ctx), database.NewInMemory(ctx)
+	_, err := database.Store(database.Put(ctx, src), &roundTripName{"Grace", "Hopper"})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+
+	var copied []interface{}
+	_, err = database.CopyWithRemap(ctx, dst, src, func(old id.ID, v interface{}) (id.ID, interface{}, error) {
+		copied = append(copied, v)
+		return id.ID{}, v, nil
+	})
+	assert.For(ctx, "CopyWithRemap").ThatError(err).Succeeded()
+	assert.For(ctx, "Copied").ThatSlice(copied).DeepEquals([]interface{}{&roundTripName{"Grace", "Hopper"}})
+}
+
+func BenchmarkHashProtoconv(b *testing.B) {
+	ctx := context.Background()
+	v := &reflectedName{"Grace", "Hopper"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		database.Hash(ctx, v)
+	}
+}
+
+func BenchmarkHashRegisteredConverter(b *testing.B) {
+	ctx := context.Background()
+	v := &directName{"Grace", "Hopper"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		database.Hash(ctx, v)
+	}
+}
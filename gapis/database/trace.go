@@ -0,0 +1,111 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/data/id"
+)
+
+// ExportTrace resolves root with the database held by the context, writing
+// the timeline of the resolvables built by the resolve to w in the Chrome
+// Trace Event JSON format, as read by chrome://tracing. Each built resolvable
+// is a duration event named by the resolvable's type, with the id as the
+// argument "id". Values already built, or being built by another caller,
+// are not re-built so do not appear in the trace. Resolvables built in
+// parallel have overlapping events.
+// The trace is written even if the resolve fails, in which case the resolve
+// error is returned.
+func ExportTrace(ctx context.Context, root id.ID, w io.Writer) error {
+	t := &resolveTrace{start: time.Now(), events: []traceEvent{}}
+	_, err := Resolve(t.bind(ctx), root)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if werr := json.NewEncoder(w).Encode(traceFile{Events: t.events}); werr != nil {
+		return werr
+	}
+	return err
+}
+
+// traceFile is the root object of a Chrome Trace Event JSON file.
+type traceFile struct {
+	Events []traceEvent `json:"traceEvents"`
+}
+
+// traceEvent is a complete event of a Chrome Trace Event JSON file.
+type traceEvent struct {
+	Name      string            `json:"name"`
+	Phase     string            `json:"ph"`
+	Timestamp float64           `json:"ts"`  // Microseconds since the start of the trace
+	Duration  float64           `json:"dur"` // Microseconds
+	PID       int               `json:"pid"`
+	TID       int               `json:"tid"`
+	Args      map[string]string `json:"args"`
+}
+
+// resolveTrace records the resolvables built by a resolve.
+type resolveTrace struct {
+	start  time.Time
+	mutex  sync.Mutex
+	events []traceEvent
+}
+
+type traceKeyTy string
+
+const traceKey = traceKeyTy("resolveTrace")
+
+// traceOf returns the trace recording the resolves made with ctx, or nil if
+// the resolves are not being traced.
+func traceOf(ctx context.Context) *resolveTrace {
+	t, _ := ctx.Value(traceKey).(*resolveTrace)
+	return t
+}
+
+func (t *resolveTrace) bind(ctx context.Context) context.Context {
+	return keys.WithValue(ctx, traceKey, t)
+}
+
+// traced returns build wrapped to record the build of id as an event named
+// name.
+func (t *resolveTrace) traced(id id.ID, name string, build func(context.Context)) func(context.Context) {
+	return func(ctx context.Context) {
+		start := time.Now()
+		defer func() {
+			end := time.Now()
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			t.events = append(t.events, traceEvent{
+				Name:      name,
+				Phase:     "X",
+				Timestamp: microseconds(start.Sub(t.start)),
+				Duration:  microseconds(end.Sub(start)),
+				PID:       1,
+				TID:       1,
+				Args:      map[string]string{"id": id.String()},
+			})
+		}()
+		build(ctx)
+	}
+}
+
+func microseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
@@ -0,0 +1,91 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestExportTrace(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	children := []id.ID{}
+	for _, name := range []string{"trace-a", "trace-b"} {
+		i, err := database.Store(ctx, newResolvable(name, func(context.Context) (interface{}, error) {
+			time.Sleep(time.Millisecond)
+			return name, nil
+		}))
+		assert.For(ctx, "Store").ThatError(err).Succeeded()
+		children = append(children, i)
+	}
+	root, err := database.Store(ctx, newResolvable("trace-root", func(ctx context.Context) (interface{}, error) {
+		for _, c := range children {
+			if _, err := database.Resolve(ctx, c); err != nil {
+				return nil, err
+			}
+		}
+		return "root", nil
+	}))
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+
+	buf := &bytes.Buffer{}
+	err = database.ExportTrace(ctx, root, buf)
+	assert.For(ctx, "ExportTrace").ThatError(err).Succeeded()
+
+	trace := struct {
+		Events []struct {
+			Name  string            `json:"name"`
+			Phase string            `json:"ph"`
+			TS    float64           `json:"ts"`
+			Dur   float64           `json:"dur"`
+			Args  map[string]string `json:"args"`
+		} `json:"traceEvents"`
+	}{}
+	err = json.Unmarshal(buf.Bytes(), &trace)
+	assert.For(ctx, "Unmarshal").ThatError(err).Succeeded()
+	assert.For(ctx, "Events").That(len(trace.Events)).Equals(3)
+
+	events := map[string]int{}
+	for i, e := range trace.Events {
+		assert.For(ctx, "Phase").That(e.Phase).Equals("X")
+		assert.For(ctx, "Name").That(e.Name).Equals("*database_test.testResolvable")
+		events[e.Args["id"]] = i
+	}
+	r := trace.Events[events[root.String()]]
+	for _, c := range children {
+		i, ok := events[c.String()]
+		assert.For(ctx, "Child traced").That(ok).Equals(true)
+		e := trace.Events[i]
+		assert.For(ctx, "Child nested").That(e.TS >= r.TS && e.TS+e.Dur <= r.TS+r.Dur).Equals(true)
+	}
+
+	// Values that are already built are not traced.
+	buf.Reset()
+	err = database.ExportTrace(ctx, root, buf)
+	assert.For(ctx, "ExportTrace").ThatError(err).Succeeded()
+	err = json.Unmarshal(buf.Bytes(), &trace)
+	assert.For(ctx, "Unmarshal").ThatError(err).Succeeded()
+	assert.For(ctx, "Cached events").That(len(trace.Events)).Equals(0)
+}
@@ -0,0 +1,149 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/config"
+)
+
+const (
+	// ErrNoTransactions is returned by Transaction when the database cannot
+	// commit changes atomically.
+	ErrNoTransactions = fault.Const("Database does not support transactions")
+	// ErrNoRef is returned by ResolveRef when the ref has not been set.
+	ErrNoRef = fault.Const("Ref not found")
+)
+
+// Tx buffers the changes made within a Transaction.
+type Tx interface {
+	// Store returns the id of v, and buffers the store of v to the database.
+	Store(v interface{}) (id.ID, error)
+	// SetRef buffers an update of the named ref to point at id. The ref can
+	// point at a value stored by the transaction.
+	SetRef(name string, id id.ID)
+}
+
+// transactor is the interface implemented by databases that can commit a set
+// of stores and ref updates atomically.
+type transactor interface {
+	// commit applies all the stores and ref updates, or none of them if any
+	// of them fail.
+	commit(ctx context.Context, stores []txStore, refs map[string]id.ID) error
+	// ref returns the id the named ref points at.
+	ref(ctx context.Context, name string) (id.ID, bool)
+}
+
+type txStore struct {
+	id id.ID
+	v  interface{}
+	m  proto.Message
+}
+
+type tx struct {
+	ctx    context.Context
+	stores []txStore
+	refs   map[string]id.ID
+}
+
+func (t *tx) Store(v interface{}) (id.ID, error) {
+	i, v, m, err := prepareStore(t.ctx, v)
+	if err != nil {
+		return id.ID{}, err
+	}
+	t.stores = append(t.stores, txStore{i, v, m})
+	return i, nil
+}
+
+func (t *tx) SetRef(name string, id id.ID) { t.refs[name] = id }
+
+// Transaction calls fn with a Tx, and then commits the stores and ref updates
+// buffered by fn to the database held by the context so that readers either
+// see all of them or none of them. If fn returns an error, or any ref points
+// at an id that is neither stored by the transaction nor in the database,
+// nothing is committed.
+func Transaction(ctx context.Context, fn func(tx Tx) error) error {
+	d, ok := Get(ctx).(transactor)
+	if !ok {
+		return ErrNoTransactions
+	}
+	t := &tx{ctx: ctx, refs: map[string]id.ID{}}
+	if err := fn(t); err != nil {
+		return err
+	}
+	return d.commit(ctx, t.stores, t.refs)
+}
+
+// ResolveRef returns the id that the named ref points at in the database held
+// by the context. Refs are set with Transaction.
+func ResolveRef(ctx context.Context, name string) (id.ID, error) {
+	d, ok := Get(ctx).(transactor)
+	if !ok {
+		return id.ID{}, ErrNoTransactions
+	}
+	i, ok := d.ref(ctx, name)
+	if !ok {
+		return id.ID{}, log.Errf(ctx, ErrNoRef, "Ref '%v'", name)
+	}
+	return i, nil
+}
+
+// Implements transactor
+func (d *memory) commit(ctx context.Context, stores []txStore, refs map[string]id.ID) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	// Check everything before changing anything, so that a failure leaves the
+	// database untouched.
+	staged := make(map[id.ID]bool, len(stores))
+	for _, s := range stores {
+		d.dropExpiredLocked(s.id)
+		if r, got := d.records[s.id]; got && config.DebugDatabaseVerify && !reflect.DeepEqual(s.m, r.proto) {
+			return fmt.Errorf("Duplicate object id %v", s.id)
+		}
+		staged[s.id] = true
+	}
+	for name, i := range refs {
+		d.dropExpiredLocked(i)
+		if _, got := d.records[i]; !got && !staged[i] {
+			return fmt.Errorf("Ref '%v' points at missing resource '%v'", name, i)
+		}
+	}
+	for _, s := range stores {
+		if err := d.storeLocked(ctx, s.id, s.v, s.m); err != nil {
+			return err
+		}
+		d.records[s.id].expires = time.Time{} // Values stored with a Tx never expire.
+	}
+	for name, i := range refs {
+		d.refs[name] = i
+	}
+	return nil
+}
+
+// Implements transactor
+func (d *memory) ref(ctx context.Context, name string) (id.ID, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	i, ok := d.refs[name]
+	return i, ok
+}
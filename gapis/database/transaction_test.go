@@ -0,0 +1,101 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+	"github.com/pkg/errors"
+)
+
+func TestTransactionCommit(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	var ada, grace id.ID
+	err := database.Transaction(ctx, func(tx database.Tx) error {
+		var err error
+		if ada, err = tx.Store(&personV2{First: "Ada"}); err != nil {
+			return err
+		}
+		if grace, err = tx.Store(&personV2{First: "Grace"}); err != nil {
+			return err
+		}
+		tx.SetRef("first", ada)
+		tx.SetRef("second", grace)
+		return nil
+	})
+	assert.For(ctx, "Transaction").ThatError(err).Succeeded()
+
+	for name, expected := range map[string]id.ID{"first": ada, "second": grace} {
+		got, err := database.ResolveRef(ctx, name)
+		assert.For(ctx, "ResolveRef %v", name).ThatError(err).Succeeded()
+		assert.For(ctx, "Ref %v", name).That(got).Equals(expected)
+	}
+	v, err := database.Resolve(ctx, grace)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	assert.For(ctx, "Value").That(v).DeepEquals(&personV2{First: "Grace"})
+}
+
+func TestTransactionRollback(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	const errAbort = fault.Const("abort")
+	missing := id.OfString("missing")
+	for _, test := range []struct {
+		name string
+		fn   func(tx database.Tx) error
+	}{
+		{"Error", func(tx database.Tx) error {
+			i, err := tx.Store(&personV2{First: "Ada"})
+			if err != nil {
+				return err
+			}
+			tx.SetRef("ref", i)
+			return errAbort
+		}},
+		{"Dangling ref", func(tx database.Tx) error {
+			if _, err := tx.Store(&personV2{First: "Ada"}); err != nil {
+				return err
+			}
+			tx.SetRef("ref", missing)
+			return nil
+		}},
+	} {
+		var stored id.ID
+		err := database.Transaction(ctx, func(tx database.Tx) error {
+			var err error
+			if stored, err = tx.Store(&personV2{First: "Grace"}); err != nil {
+				return err
+			}
+			return test.fn(tx)
+		})
+		assert.For(ctx, "%v transaction", test.name).ThatError(err).Failed()
+		_, err = database.Resolve(ctx, stored)
+		assert.For(ctx, "%v resolve", test.name).ThatError(err).Failed()
+		ada, err := database.Hash(ctx, &personV2{First: "Ada"})
+		assert.For(ctx, "Hash").ThatError(err).Succeeded()
+		_, err = database.Resolve(ctx, ada)
+		assert.For(ctx, "%v resolve staged", test.name).ThatError(err).Failed()
+		_, err = database.ResolveRef(ctx, "ref")
+		assert.For(ctx, "%v ref", test.name).That(errors.Cause(err)).Equals(database.ErrNoRef)
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/data/id"
+)
+
+// ResolveTransform returns the result of calling fn with the value of i,
+// along with the id the result is stored under. The result is stored to the
+// database held by the context under an id derived from i and tag with
+// DerivedID, where tag names the transform, so fn is only called the first
+// time the transform of i is needed, and concurrent callers share a single
+// call. The base value is only resolved when fn needs to be called.
+// The result of fn must be convertible to a proto so it can be stored.
+func ResolveTransform(ctx context.Context, i id.ID, tag string, fn func(ctx context.Context, base interface{}) (interface{}, error)) (id.ID, interface{}, error) {
+	derived := DerivedID([]id.ID{i}, "transform:"+tag)
+	out, err := GetOrCompute(ctx, derived, func(ctx context.Context) (interface{}, error) {
+		base, err := Resolve(ctx, i)
+		if err != nil {
+			return nil, err
+		}
+		return fn(ctx, base)
+	})
+	if err != nil {
+		return derived, nil, err
+	}
+	return derived, out, nil
+}
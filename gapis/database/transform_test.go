@@ -0,0 +1,69 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestResolveTransform(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	base, err := database.Store(ctx, &personV2{First: "Ada", Last: "Lovelace"})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+
+	calls := int32(0)
+	fullName := func(ctx context.Context, v interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		p := v.(*personV2)
+		return &personV2{First: p.First + " " + p.Last}, nil
+	}
+	expected := &personV2{First: "Ada Lovelace"}
+
+	first, got, err := database.ResolveTransform(ctx, base, "full-name", fullName)
+	assert.For(ctx, "ResolveTransform").ThatError(err).Succeeded()
+	assert.For(ctx, "Result").That(got).DeepEquals(expected)
+
+	wg := sync.WaitGroup{}
+	for n := 0; n < 8; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			i, got, err := database.ResolveTransform(ctx, base, "full-name", fullName)
+			assert.For(ctx, "ResolveTransform").ThatError(err).Succeeded()
+			assert.For(ctx, "Id").That(i).Equals(first)
+			assert.For(ctx, "Result").That(got).DeepEquals(expected)
+		}()
+	}
+	wg.Wait()
+	assert.For(ctx, "Calls").That(atomic.LoadInt32(&calls)).Equals(int32(1))
+
+	stored, err := database.Resolve(ctx, first)
+	assert.For(ctx, "Resolve result").ThatError(err).Succeeded()
+	assert.For(ctx, "Stored result").That(stored).DeepEquals(expected)
+
+	other, _, err := database.ResolveTransform(ctx, base, "other", fullName)
+	assert.For(ctx, "ResolveTransform other").ThatError(err).Succeeded()
+	assert.For(ctx, "Other id").That(other == first).Equals(false)
+	assert.For(ctx, "Calls").That(atomic.LoadInt32(&calls)).Equals(int32(2))
+}
@@ -0,0 +1,72 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/fault"
+)
+
+// ErrNoUncached is returned by ResolveUncached when the database does not
+// support uncached resolves.
+const ErrNoUncached = fault.Const("Database does not support uncached resolves")
+
+// uncachedResolver is the interface implemented by databases that can build a
+// value without using or updating their caches.
+type uncachedResolver interface {
+	resolveUncached(ctx context.Context, id id.ID) (interface{}, error)
+}
+
+// ResolveUncached builds the value of id from its stored resolvable using the
+// database held by the context, ignoring any value the database has cached
+// for id. The built value is returned without being cached, so the cached
+// value for id, if any, is left as it is. This allows a cached value to be
+// compared against a fresh build, to check that the resolvable is
+// deterministic. Values that the resolvable itself resolves are resolved as
+// normal, using the caches.
+func ResolveUncached(ctx context.Context, id id.ID) (interface{}, error) {
+	u, ok := Get(ctx).(uncachedResolver)
+	if !ok {
+		return nil, ErrNoUncached
+	}
+	return u.resolveUncached(ctx, id)
+}
+
+// Implements uncachedResolver
+func (d *memory) resolveUncached(ctx context.Context, id id.ID) (interface{}, error) {
+	d.mutex.Lock()
+	id, err := d.partitionLocked(ctx, id)
+	if err != nil {
+		d.mutex.Unlock()
+		return nil, err
+	}
+	_, r, err := d.lookupLocked(ctx, id)
+	if err != nil {
+		d.mutex.Unlock()
+		return nil, err
+	}
+	// Build from a new record holding just the stored definition, which does
+	// not change once stored, so the record's cached value is not replaced
+	// and a resolve of the record can build it at the same time.
+	fresh := &record{proto: r.proto, params: r.params}
+	d.mutex.Unlock()
+
+	if _, err := fresh.resolve(fresh.bindParams(ctx)); err != nil {
+		return nil, err
+	}
+	return fresh.object, nil
+}
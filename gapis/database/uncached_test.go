@@ -0,0 +1,89 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestResolveUncached(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	// The first build caches a wrong value.
+	builds := 0
+	i, err := database.Store(ctx, newResolvable("uncached", func(context.Context) (interface{}, error) {
+		builds++
+		if builds == 1 {
+			return "wrong", nil
+		}
+		return "right", nil
+	}))
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	got, err := database.Resolve(ctx, i)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+	assert.For(ctx, "Cached").That(got).Equals("wrong")
+
+	got, err = database.ResolveUncached(ctx, i)
+	assert.For(ctx, "ResolveUncached").ThatError(err).Succeeded()
+	assert.For(ctx, "Fresh").That(got).Equals("right")
+	assert.For(ctx, "Builds").That(builds).Equals(2)
+
+	got, cached, err := database.ResolveCachedOnly(ctx, i)
+	assert.For(ctx, "ResolveCachedOnly").ThatError(err).Succeeded()
+	assert.For(ctx, "Still cached").That(cached).Equals(true)
+	assert.For(ctx, "Cache untouched").That(got).Equals("wrong")
+
+	// Values that are not resolvable are returned as stored.
+	p := &personV2{First: "Ada"}
+	pid, err := database.Store(ctx, p)
+	assert.For(ctx, "Store proto").ThatError(err).Succeeded()
+	got, err = database.ResolveUncached(ctx, pid)
+	assert.For(ctx, "ResolveUncached proto").ThatError(err).Succeeded()
+	assert.For(ctx, "Proto").That(got).DeepEquals(p)
+}
+
+func TestResolveUncachedDuringResolve(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	started, release := make(chan struct{}), make(chan struct{})
+	builds := int32(0)
+	i, err := database.Store(ctx, newResolvable("uncached-in-flight", func(context.Context) (interface{}, error) {
+		if atomic.AddInt32(&builds, 1) == 1 {
+			close(started)
+			<-release // Hold the first build until ResolveUncached returns.
+		}
+		return "value", nil
+	}))
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	done := make(chan error)
+	go func() {
+		_, err := database.Resolve(ctx, i)
+		done <- err
+	}()
+	<-started
+	got, err := database.ResolveUncached(ctx, i)
+	assert.For(ctx, "ResolveUncached").ThatError(err).Succeeded()
+	assert.For(ctx, "Fresh").That(got).Equals("value")
+	close(release)
+	assert.For(ctx, "Resolve").ThatError(<-done).Succeeded()
+}
@@ -0,0 +1,182 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+)
+
+// ErrNoVerify is returned by Verify and Repair when the database cannot check
+// the integrity of its entries.
+const ErrNoVerify = fault.Const("Database does not support verification")
+
+// WithVerification returns an Option that records a digest of every value
+// built by a resolvable, so that Verify and Repair can detect built values
+// that were modified after they were built. Without this option only the
+// stored protos are verified.
+func WithVerification() Option {
+	return func(m *memory) { m.verifyBuilt = true }
+}
+
+// verifier is the interface implemented by databases that can check the
+// integrity of their entries.
+type verifier interface {
+	// verify returns the ids of the entries that fail integrity, and whether
+	// each can be rebuilt from its stored resolvable.
+	verify(context.Context) map[id.ID]bool
+	// rebuild discards the built value of the entry with the given id and
+	// builds it again from its stored resolvable.
+	rebuild(context.Context, id.ID) error
+}
+
+// Verify checks the integrity of all the entries of db, returning the ids of
+// the entries that fail. An entry fails if its stored proto no longer hashes
+// to its id, or if its built value no longer matches the digest recorded when
+// it was built. See WithVerification. The stored protos of entries stored
+// under ids that are not their hash, such as those stored by GetOrCompute,
+// are not checked. The entries are hashed without holding up other users of
+// db.
+func Verify(ctx context.Context, db Database) ([]id.ID, error) {
+	v, ok := db.(verifier)
+	if !ok {
+		return nil, ErrNoVerify
+	}
+	out := []id.ID{}
+	for i := range v.verify(ctx) {
+		out = append(out, i)
+	}
+	sortIDs(out)
+	return out, nil
+}
+
+// Repair verifies all the entries of db like Verify, rebuilding each entry
+// with a corrupt built value from its stored resolvable. Entries whose
+// stored proto is corrupt cannot be rebuilt, and are returned in
+// unrecoverable along with the entries that fail to rebuild.
+func Repair(ctx context.Context, db Database) (repaired, unrecoverable []id.ID, err error) {
+	v, ok := db.(verifier)
+	if !ok {
+		return nil, nil, ErrNoVerify
+	}
+	repaired, unrecoverable = []id.ID{}, []id.ID{}
+	for i, recoverable := range v.verify(ctx) {
+		if recoverable {
+			if err := v.rebuild(ctx, i); err != nil {
+				log.W(ctx, "Failed to rebuild %v: %v", i, err)
+			} else {
+				repaired = append(repaired, i)
+				continue
+			}
+		}
+		unrecoverable = append(unrecoverable, i)
+	}
+	sortIDs(repaired)
+	sortIDs(unrecoverable)
+	return repaired, unrecoverable, nil
+}
+
+func sortIDs(ids []id.ID) {
+	sort.Slice(ids, func(i, j int) bool { return bytes.Compare(ids[i][:], ids[j][:]) < 0 })
+}
+
+// digestValue returns the hash of the value v, or an invalid id if v cannot be
+// converted to a proto.
+func digestValue(ctx context.Context, v interface{}) id.ID {
+	m, err := toProto(ctx, v)
+	if err != nil {
+		return id.ID{}
+	}
+	out, err := hashProto(v, m)
+	if err != nil {
+		return id.ID{}
+	}
+	return out
+}
+
+// digestLocked records the digest of the value built for r if the database
+// verifies built values.
+// digestLocked must be called with a locked mutex.
+func (d *memory) digestLocked(r *record, rs *resolveState) {
+	if d.verifyBuilt && r.recomputable {
+		rs.digest = digestValue(d.resolveCtx, rs.value)
+	}
+}
+
+// verifyEntry is the state of a record needed to verify it.
+type verifyEntry struct {
+	id         id.ID
+	storedType reflect.Type  // Type of the value the id was hashed from
+	proto      proto.Message // The stored proto
+	hashed     bool          // True if the id is the hash of the stored proto
+	value      interface{}   // The built value, if it has a digest
+	digest     id.ID         // The digest of the built value when it was built
+	resolvable bool          // True if the value can be rebuilt
+}
+
+// Implements verifier
+func (d *memory) verify(ctx context.Context) map[id.ID]bool {
+	// Take the state to check under the lock, and hash it without the lock so
+	// the database can be used while it is verified.
+	d.mutex.Lock()
+	entries := make([]verifyEntry, 0, len(d.records))
+	for i, r := range d.records {
+		// Partitions share the proto of the record they partition.
+		e := verifyEntry{
+			id:         i,
+			storedType: r.storedType,
+			proto:      r.proto,
+			hashed:     !r.partition && !r.derived,
+			resolvable: r.resolvable,
+		}
+		if rs := r.resolveState; rs != nil && rs.finished == nil && rs.err == nil && rs.digest.IsValid() {
+			e.value, e.digest = rs.value, rs.digest
+		}
+		entries = append(entries, e)
+	}
+	d.mutex.Unlock()
+
+	out := map[id.ID]bool{}
+	for _, e := range entries {
+		if e.hashed {
+			if got, err := hashTyped(e.storedType, e.proto); err != nil || got != e.id {
+				out[e.id] = false // The stored proto is corrupt.
+				continue
+			}
+		}
+		if e.digest.IsValid() && digestValue(ctx, e.value) != e.digest {
+			out[e.id] = e.resolvable
+		}
+	}
+	return out
+}
+
+// Implements verifier
+func (d *memory) rebuild(ctx context.Context, id id.ID) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if r, got := d.records[id]; got && r.resolveState != nil && r.resolveState.finished == nil {
+		d.invalidateLocked(id, r)
+	}
+	_, err := d.resolveLocked(ctx, id)
+	return err
+}
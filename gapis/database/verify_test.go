@@ -0,0 +1,96 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestRepair(t *testing.T) {
+	ctx := log.Testing(t)
+	d := database.NewInMemory(ctx, database.WithVerification())
+	ctx = database.Put(ctx, d)
+
+	blob := &personV2{First: "Ada", Last: "Lovelace"}
+	blobID, err := database.Store(ctx, blob)
+	assert.For(ctx, "Store blob").ThatError(err).Succeeded()
+	builtID, err := database.Store(ctx, newResolvable("repair", func(context.Context) (interface{}, error) {
+		return &personV2{First: "Grace", Last: "Hopper"}, nil
+	}))
+	assert.For(ctx, "Store resolvable").ThatError(err).Succeeded()
+	built, err := database.Resolve(ctx, builtID)
+	assert.For(ctx, "Resolve").ThatError(err).Succeeded()
+
+	failed, err := database.Verify(ctx, d)
+	assert.For(ctx, "Verify").ThatError(err).Succeeded()
+	assert.For(ctx, "Failed").ThatSlice(failed).IsEmpty()
+
+	// Modify the stored and built values in place.
+	blob.First = "Eve"
+	built.(*personV2).First = "Mallory"
+
+	failed, err = database.Verify(ctx, d)
+	assert.For(ctx, "Verify").ThatError(err).Succeeded()
+	expected := []id.ID{blobID, builtID}
+	if bytes.Compare(blobID[:], builtID[:]) > 0 {
+		expected = []id.ID{builtID, blobID}
+	}
+	assert.For(ctx, "Failed").ThatSlice(failed).Equals(expected)
+
+	repaired, unrecoverable, err := database.Repair(ctx, d)
+	assert.For(ctx, "Repair").ThatError(err).Succeeded()
+	assert.For(ctx, "Repaired").ThatSlice(repaired).Equals([]id.ID{builtID})
+	assert.For(ctx, "Unrecoverable").ThatSlice(unrecoverable).Equals([]id.ID{blobID})
+
+	got, err := database.Resolve(ctx, builtID)
+	assert.For(ctx, "Resolve repaired").ThatError(err).Succeeded()
+	assert.For(ctx, "Repaired value").That(got).DeepEquals(&personV2{First: "Grace", Last: "Hopper"})
+	failed, err = database.Verify(ctx, d)
+	assert.For(ctx, "Verify").ThatError(err).Succeeded()
+	assert.For(ctx, "Failed").ThatSlice(failed).Equals([]id.ID{blobID})
+}
+
+func TestVerifyDerivedIDs(t *testing.T) {
+	ctx := log.Testing(t)
+	d := database.NewInMemory(ctx, database.WithVerification())
+	ctx = database.Put(ctx, d)
+
+	// Values stored under ids that are not their hash are not corrupt.
+	_, err := database.GetOrCompute(ctx, id.OfString("computed"), func(context.Context) (interface{}, error) {
+		return &personV2{First: "Ada"}, nil
+	})
+	assert.For(ctx, "GetOrCompute").ThatError(err).Succeeded()
+	base, err := database.Store(ctx, &personV2{First: "Grace"})
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	_, _, err = database.ResolveTransform(ctx, base, "upper", func(ctx context.Context, v interface{}) (interface{}, error) {
+		return &personV2{First: "GRACE"}, nil
+	})
+	assert.For(ctx, "ResolveTransform").ThatError(err).Succeeded()
+
+	failed, err := database.Verify(ctx, d)
+	assert.For(ctx, "Verify").ThatError(err).Succeeded()
+	assert.For(ctx, "Failed").ThatSlice(failed).IsEmpty()
+	repaired, unrecoverable, err := database.Repair(ctx, d)
+	assert.For(ctx, "Repair").ThatError(err).Succeeded()
+	assert.For(ctx, "Repaired").ThatSlice(repaired).IsEmpty()
+	assert.For(ctx, "Unrecoverable").ThatSlice(unrecoverable).IsEmpty()
+}
@@ -0,0 +1,58 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+)
+
+// stackDumpLimit is the maximum number of bytes of goroutine stacks included
+// in a watchdog report.
+const stackDumpLimit = 1 << 20
+
+// WithResolveWatchdog returns an Option that logs a warning, holding the id
+// and resolvable type, for any single resolve that runs for longer than d.
+// The watchdog does not cancel the resolve, it only makes stuck work visible.
+func WithResolveWatchdog(d time.Duration) Option {
+	return func(m *memory) { m.watchdog = d }
+}
+
+// WithResolveWatchdogDump returns an Option that includes a dump of all the
+// goroutine stacks with each warning logged by the resolve watchdog.
+func WithResolveWatchdogDump() Option {
+	return func(m *memory) { m.watchdogDump = true }
+}
+
+// watch starts the watchdog timer for the resolve of the record with the
+// given id and typename. The returned function stops the timer and must be
+// called once the resolve has finished.
+func (d *memory) watch(ctx context.Context, id id.ID, typename string) (stop func()) {
+	start := time.Now()
+	t := time.AfterFunc(d.watchdog, func() {
+		if !d.watchdogDump {
+			log.W(ctx, "Resolve of %v (%v) has been running for %v", id, typename, time.Since(start))
+			return
+		}
+		buf := make([]byte, stackDumpLimit)
+		buf = buf[:runtime.Stack(buf, true)]
+		log.W(ctx, "Resolve of %v (%v) has been running for %v\n%s", id, typename, time.Since(start), buf)
+	})
+	return func() { t.Stop() }
+}
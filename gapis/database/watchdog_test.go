@@ -0,0 +1,59 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestResolveWatchdog(t *testing.T) {
+	ctx := log.Testing(t)
+	warnings := make(chan string, 8)
+	handler := log.NewHandler(func(m *log.Message) {
+		if m.Severity == log.Warning {
+			warnings <- m.Text
+		}
+	}, nil)
+	dbCtx := log.PutHandler(ctx, handler)
+	ctx = database.Put(ctx, database.NewInMemory(dbCtx, database.WithResolveWatchdog(10*time.Millisecond)))
+
+	release := make(chan struct{})
+	r := newResolvable("watchdog-stuck", func(context.Context) (interface{}, error) {
+		<-release
+		return "done", nil
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := database.Build(ctx, r)
+		assert.For(ctx, "Build").ThatError(err).Succeeded()
+	}()
+
+	select {
+	case msg := <-warnings:
+		assert.For(ctx, "Warning names type").That(strings.Contains(msg, "testResolvable")).Equals(true)
+	case <-time.After(5 * time.Second):
+		assert.For(ctx, "Watchdog").Error("No warning logged for stuck resolve")
+	}
+	close(release)
+	<-done
+}
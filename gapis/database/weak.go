@@ -0,0 +1,88 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+
+	"github.com/google/gapid/core/event/task"
+)
+
+// NewMemoryDatabaseWeak builds a new in memory database that holds the values
+// built by resolvables weakly. Each time the garbage collector runs, values
+// that have not been resolved since the previous collection are released,
+// and are transparently rebuilt from their strongly held resolvable on the
+// next resolve. Values are reclaimed until ctx is cancelled or the returned
+// database is no longer referenced, after which the database can itself be
+// garbage collected.
+func NewMemoryDatabaseWeak(ctx context.Context, opts ...Option) Database {
+	m := NewInMemory(ctx, opts...).(*memory)
+	w := &weakMemory{m}
+	s := &weakState{d: m}
+	runtime.SetFinalizer(w, func(*weakMemory) { atomic.StoreInt32(&s.released, 1) })
+	s.arm()
+	return w
+}
+
+// weakMemory is the handle returned by NewMemoryDatabaseWeak. The reclaimer
+// only references the wrapped memory, so the handle becoming unreachable is
+// what tells the reclaimer to stop.
+type weakMemory struct{ *memory }
+
+// weakState is shared by the chain of reclaimer sentinels of a database.
+type weakState struct {
+	d        *memory
+	released int32 // Set to 1 once the weakMemory handle has been collected
+}
+
+// reclaimer is a sentinel object used to detect garbage collections.
+type reclaimer struct{ s *weakState }
+
+// arm creates a new unreferenced sentinel that has a finalizer which reclaims
+// the resolved values of the database.
+func (s *weakState) arm() {
+	runtime.SetFinalizer(&reclaimer{s}, (*reclaimer).collected)
+}
+
+func (r *reclaimer) collected() {
+	if atomic.LoadInt32(&r.s.released) != 0 {
+		return
+	}
+	select {
+	case <-task.ShouldStop(r.s.d.resolveCtx):
+		return
+	default:
+	}
+	r.s.d.reclaim()
+	r.s.arm()
+}
+
+// reclaim releases all the values built by resolvables that have finished
+// resolving and have not been resolved since the last call to reclaim.
+func (d *memory) reclaim() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for id, r := range d.records {
+		rs := r.resolveState
+		if !r.recomputable || rs == nil || rs.finished != nil || r.pins > 0 || r.generation >= d.generation {
+			continue
+		}
+		d.invalidateLocked(id, r)
+		d.counters.evictions++
+	}
+	d.generation++
+}
@@ -0,0 +1,53 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+)
+
+// tracked is a value whose collection is observed with a finalizer.
+type tracked struct{ next *tracked }
+
+// storeTracked stores a tracked value in a new weak database that is dropped
+// on return, and returns a channel that is closed when the value is collected.
+func storeTracked(t *testing.T) chan struct{} {
+	ctx := log.Testing(t)
+	d := NewMemoryDatabaseWeak(ctx)
+	v, collected := &tracked{}, make(chan struct{})
+	runtime.SetFinalizer(v, func(*tracked) { close(collected) })
+	d.store(ctx, id.OfString("tracked"), v, nil)
+	return collected
+}
+
+func TestWeakDatabaseReleased(t *testing.T) {
+	ctx := log.Testing(t)
+	collected := storeTracked(t)
+	for i := 0; i < 20; i++ {
+		runtime.GC()
+		select {
+		case <-collected:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	assert.For(ctx, "Database collected").That(false).Equals(true)
+}
@@ -0,0 +1,59 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database_test
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestWeakValuesRecomputedAfterGC(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx, cancel := task.WithCancel(ctx)
+	defer cancel()
+	ctx = database.Put(ctx, database.NewMemoryDatabaseWeak(ctx))
+
+	calls := int32(0)
+	r := newResolvable("weak-recompute", func(context.Context) (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	})
+	i, err := database.Store(ctx, r)
+	assert.For(ctx, "Store").ThatError(err).Succeeded()
+	got, err := database.Resolve(ctx, i)
+	assert.For(ctx, "First resolve").ThatError(err).Succeeded()
+	assert.For(ctx, "First value").That(got).Equals(int32(1))
+	got, err = database.Resolve(ctx, i)
+	assert.For(ctx, "Cached resolve").ThatError(err).Succeeded()
+	assert.For(ctx, "Cached value").That(got).Equals(int32(1))
+
+	// Finalizers run asynchronously, so keep collecting until the value is
+	// reclaimed.
+	for attempt := 0; attempt < 100 && got == int32(1); attempt++ {
+		runtime.GC()
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+		got, err = database.Resolve(ctx, i)
+		assert.For(ctx, "Resolve after GC").ThatError(err).Succeeded()
+	}
+	assert.For(ctx, "Recomputed value").That(got).Equals(int32(2))
+}